@@ -0,0 +1,204 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var authUsername string
+var authEmail string
+var authPassword string
+
+// promptPassword asks for a password without echoing it if stdin is a
+// terminal
+func promptPassword(r *bufio.Reader, label string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return promptValue(r, label, "", "")
+	}
+
+	fmt.Printf("%s: ", label)
+	password, err := terminal.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+// promptCredentials asks for the username or email and the password not
+// given by flags
+func promptCredentials() (username, email, password string, err error) {
+	username, email, password = authUsername, authEmail, authPassword
+	r := bufio.NewReader(os.Stdin)
+
+	if username == "" && email == "" {
+		var login string
+		login, err = promptValue(r, "Username or email", "", "")
+		if err != nil {
+			return
+		}
+		if strings.Contains(login, "@") {
+			email = login
+		} else {
+			username = login
+		}
+	}
+	if username == "" && email == "" {
+		err = fmt.Errorf("Username or email is required.")
+		return
+	}
+
+	if password == "" {
+		password, err = promptPassword(r, "Password")
+	}
+	return
+}
+
+// saveAccessToken writes the access token to the current profile in the
+// config file. The access token is removed if it is empty.
+func saveAccessToken(accessToken string) (string, error) {
+	return updateConfigFile(func(data map[string]interface{}) error {
+		if accessToken == "" {
+			unsetConfigValue(data, editingProfile(), "access_token")
+		} else {
+			setConfigValue(data, editingProfile(), "access_token", accessToken)
+		}
+		return nil
+	})
+}
+
+func printUser(user *skycontainer.User) {
+	fmt.Printf("User ID: %s\n", user.UserID)
+	if user.Username != "" {
+		fmt.Printf("Username: %s\n", user.Username)
+	}
+	if user.Email != "" {
+		fmt.Printf("Email: %s\n", user.Email)
+	}
+	if len(user.Roles) > 0 {
+		fmt.Printf("Roles: %s\n", strings.Join(user.Roles, ", "))
+	}
+}
+
+// authenticate logs in or signs up with auth, and saves the access token
+func authenticate(auth func(username, email, password string) (*skycontainer.User, error)) {
+	username, email, password, err := promptCredentials()
+	if err != nil {
+		fatal(err)
+	}
+
+	user, err := auth(username, email, password)
+	if err != nil {
+		fatal(err)
+	}
+
+	path, err := saveAccessToken(user.AccessToken)
+	if err != nil {
+		fatal(err)
+	}
+	printUser(user)
+	fmt.Printf("Access token saved to %s.\n", path)
+}
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage the user of skycli",
+	Long: `Log in or sign up as a user of the server. The access token is saved to the
+current profile so that subsequent commands run as that user.`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in as a user",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMaxArgCount(cmd, args, 0)
+		authenticate(newContainer().Login)
+	},
+}
+
+var authSignupCmd = &cobra.Command{
+	Use:   "signup",
+	Short: "Sign up as a new user",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMaxArgCount(cmd, args, 0)
+		authenticate(newContainer().Signup)
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Log out and remove the access token",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMaxArgCount(cmd, args, 0)
+
+		c := newContainer()
+		if c.AccessToken == "" {
+			fatal(fmt.Errorf("Not logged in."))
+		}
+
+		err := c.Logout()
+		if err != nil {
+			warn(err)
+		}
+
+		path, err := saveAccessToken("")
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Access token removed from %s.\n", path)
+	},
+}
+
+var authWhoAmICmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Print the current user",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMaxArgCount(cmd, args, 0)
+
+		c := newContainer()
+		if c.AccessToken == "" {
+			fatal(fmt.Errorf("Not logged in."))
+		}
+
+		user, err := c.WhoAmI()
+		if err != nil {
+			fatal(err)
+		}
+		printUser(user)
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{authLoginCmd, authSignupCmd} {
+		cmd.Flags().StringVar(&authUsername, "username", "", "Username of the user")
+		cmd.Flags().StringVar(&authEmail, "email", "", "Email of the user")
+		cmd.Flags().StringVar(&authPassword, "password", "", "Password of the user. Prompted if not specified.")
+	}
+	authCmd.PersistentFlags().BoolVar(&configNoProfile, "no-profile", false, "Save the access token at the top level of the config file instead of the current profile")
+
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authSignupCmd)
+	authCmd.AddCommand(authLogoutCmd)
+	authCmd.AddCommand(authWhoAmICmd)
+}
@@ -0,0 +1,175 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+func TestAuth(t *testing.T) {
+	Convey("Auth", t, func() {
+		var requests []map[string]interface{}
+		var tokenHeaders []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&payload)
+			requests = append(requests, payload)
+			tokenHeaders = append(tokenHeaders, r.Header.Get("X-Skygear-Access-Token"))
+
+			user := map[string]interface{}{
+				"user_id":      "alice-id",
+				"username":     "alice",
+				"access_token": "alice-token",
+				"roles":        []string{"admin"},
+			}
+			switch {
+			case r.URL.Path == "/auth/login" && payload["password"] != "secret":
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"error": map[string]interface{}{
+						"name":    "InvalidCredentials",
+						"message": "invalid authentication information",
+					},
+				})
+			case r.URL.Path == "/auth/logout":
+				json.NewEncoder(w).Encode(map[string]interface{}{"result": "OK"})
+			default:
+				json.NewEncoder(w).Encode(map[string]interface{}{"result": user})
+			}
+		}))
+		defer server.Close()
+
+		c := &skycontainer.Container{Endpoint: server.URL + "/"}
+
+		Convey("logs in", func() {
+			user, err := c.Login("alice", "", "secret")
+			So(err, ShouldBeNil)
+			So(user, ShouldResemble, &skycontainer.User{
+				UserID:      "alice-id",
+				Username:    "alice",
+				Roles:       []string{"admin"},
+				AccessToken: "alice-token",
+			})
+			So(c.AccessToken, ShouldEqual, "alice-token")
+			So(requests[0]["action"], ShouldEqual, "auth:login")
+			So(requests[0]["username"], ShouldEqual, "alice")
+
+			_, err = c.WhoAmI()
+			So(err, ShouldBeNil)
+			So(requests[1]["action"], ShouldEqual, "me")
+			So(requests[1]["access_token"], ShouldEqual, "alice-token")
+
+			So(c.Logout(), ShouldBeNil)
+			So(c.AccessToken, ShouldEqual, "")
+		})
+
+		Convey("logs in without the current access token", func() {
+			c.AccessToken = "expired-token"
+			_, err := c.Login("alice", "", "secret")
+			So(err, ShouldBeNil)
+			So(requests[0], ShouldNotContainKey, "access_token")
+			So(tokenHeaders[0], ShouldEqual, "")
+
+			c.AccessToken = "expired-token"
+			_, err = c.Signup("alice", "", "secret")
+			So(err, ShouldBeNil)
+			So(requests[1], ShouldNotContainKey, "access_token")
+			So(tokenHeaders[1], ShouldEqual, "")
+			So(c.AccessToken, ShouldEqual, "alice-token")
+		})
+
+		Convey("fails to log in with wrong password", func() {
+			_, err := c.Login("", "alice@example.com", "wrong")
+			So(err, ShouldNotBeNil)
+			So(requests[0]["email"], ShouldEqual, "alice@example.com")
+			So(c.AccessToken, ShouldEqual, "")
+		})
+	})
+}
+
+func TestSaveAccessToken(t *testing.T) {
+	Convey("Save access token", t, func() {
+		dir, err := ioutil.TempDir("", "skycli")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		configFile := filepath.Join(dir, "config.toml")
+		So(ioutil.WriteFile(configFile, []byte(testConfig), 0644), ShouldBeNil)
+		configFileUsed = configFile
+		viper.Set("current_profile", "production")
+		defer func() {
+			configFileUsed = ""
+			viper.Set("current_profile", "")
+		}()
+
+		_, err = saveAccessToken("production-token")
+		So(err, ShouldBeNil)
+		data, err := readConfigData(configFile)
+		So(err, ShouldBeNil)
+		So(configSection(data, "production", "access_token", false)["access_token"], ShouldEqual, "production-token")
+		So(data, ShouldNotContainKey, "access_token")
+
+		_, err = saveAccessToken("")
+		So(err, ShouldBeNil)
+		data, err = readConfigData(configFile)
+		So(err, ShouldBeNil)
+		So(configSection(data, "production", "access_token", false), ShouldNotContainKey, "access_token")
+	})
+}
+
+func TestMasterKey(t *testing.T) {
+	Convey("Master key", t, func() {
+		var apiKey string
+		var payload map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey = r.Header.Get("X-Skygear-API-Key")
+			json.NewDecoder(r.Body).Decode(&payload)
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": []interface{}{}})
+		}))
+		defer server.Close()
+
+		Convey("is sent in place of API key", func() {
+			c := &skycontainer.Container{Endpoint: server.URL + "/", APIKey: "api", MasterKey: "master"}
+			_, err := c.MakeRequest("schema:fetch", &skycontainer.GenericRequest{Payload: map[string]interface{}{}})
+			So(err, ShouldBeNil)
+			So(apiKey, ShouldEqual, "master")
+			So(payload, ShouldNotContainKey, "_user_id")
+		})
+
+		Convey("acts as user", func() {
+			c := &skycontainer.Container{Endpoint: server.URL + "/", MasterKey: "master", UserID: "alice-id"}
+			_, err := c.MakeRequest("schema:fetch", &skycontainer.GenericRequest{Payload: map[string]interface{}{}})
+			So(err, ShouldBeNil)
+			So(payload["_user_id"], ShouldEqual, "alice-id")
+		})
+
+		Convey("does not act as user without master key", func() {
+			c := &skycontainer.Container{Endpoint: server.URL + "/", APIKey: "api", UserID: "alice-id"}
+			_, err := c.MakeRequest("schema:fetch", &skycontainer.GenericRequest{Payload: map[string]interface{}{}})
+			So(err, ShouldBeNil)
+			So(apiKey, ShouldEqual, "api")
+			So(payload, ShouldNotContainKey, "_user_id")
+		})
+	})
+}
@@ -0,0 +1,559 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	skyrecord "github.com/skygeario/skycli/record"
+	"github.com/spf13/cobra"
+)
+
+const backupManifestVersion = 1
+const backupManifestFile = "manifest.json"
+const backupSchemaFile = "schema.json"
+const backupRecordsDir = "records"
+const backupAssetsDir = "assets"
+
+var backupIncludePrivate bool
+
+// backupMetaKeys are the reserved keys of records kept in backups, which
+// are the access control list and the owner of records. They can only be
+// restored with master key.
+var backupMetaKeys = []string{"_access", "_ownerID"}
+
+// takeRecordMeta removes the backupMetaKeys from the record and returns
+// their values
+func takeRecordMeta(record *skyrecord.Record) map[string]interface{} {
+	meta := map[string]interface{}{}
+	for _, key := range backupMetaKeys {
+		if value, ok := record.Data[key]; ok {
+			meta[key] = value
+			delete(record.Data, key)
+		}
+	}
+	return meta
+}
+
+// backupManifest describes the content of a backup directory
+type backupManifest struct {
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	Endpoint    string    `json:"endpoint"`
+	Databases   []string  `json:"databases"`
+	RecordTypes []string  `json:"record_types"`
+	// RecordCount maps database ID and record type to number of records
+	RecordCount map[string]map[string]int `json:"record_count"`
+	// Files maps path of each file in the backup to its SHA-256 checksum
+	Files map[string]string `json:"files"`
+}
+
+var refTypeRegexp = regexp.MustCompile(`^ref\((.+)\)$`)
+
+// schemaFields returns the fields of a record type in the schema
+func schemaFields(schema map[string]interface{}, recordType string) []map[string]interface{} {
+	recordSchema, ok := schema[recordType].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	fieldList, _ := recordSchema["fields"].([]interface{})
+	var fields []map[string]interface{}
+	for _, f := range fieldList {
+		if field, ok := f.(map[string]interface{}); ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// recordTypeOrder sorts record types so that record types referenced by
+// a record type come before it. Record types in a reference cycle are
+// sorted by name.
+func recordTypeOrder(schema map[string]interface{}) []string {
+	var names []string
+	for recordType := range schema {
+		names = append(names, recordType)
+	}
+	sort.Strings(names)
+
+	var order []string
+	visited := map[string]bool{}
+	var visit func(recordType string)
+	visit = func(recordType string) {
+		if visited[recordType] {
+			return
+		}
+		visited[recordType] = true
+
+		for _, field := range schemaFields(schema, recordType) {
+			fieldType, _ := field["type"].(string)
+			if match := refTypeRegexp.FindStringSubmatch(fieldType); match != nil {
+				if _, ok := schema[match[1]]; ok {
+					visit(match[1])
+				}
+			}
+		}
+		order = append(order, recordType)
+	}
+
+	for _, recordType := range names {
+		visit(recordType)
+	}
+	return order
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumDirectory returns the checksums of all files in the backup
+// directory except the manifest
+func checksumDirectory(dir string) (map[string]string, error) {
+	checksums := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == backupManifestFile {
+			return nil
+		}
+
+		checksum, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+		checksums[relPath] = checksum
+		return nil
+	})
+	return checksums, err
+}
+
+func recordsFilePath(dir, databaseID, recordType string) string {
+	return filepath.Join(dir, backupRecordsDir, databaseID, recordType+".json")
+}
+
+// backupRecords writes all records of the record type in db to the backup
+// directory, and returns the number of records written
+func backupRecords(db skycontainer.SkyDB, databaseID, recordType, dir string) (int, error) {
+	err := os.MkdirAll(filepath.Join(dir, backupRecordsDir, databaseID), 0755)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Create(recordsFilePath(dir, databaseID, recordType))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	assetDir := filepath.Join(dir, backupAssetsDir)
+	// Relative to the records file
+	assetPathPrefix := "../../" + backupAssetsDir
+
+	enc := json.NewEncoder(f)
+	count := 0
+	query := skycontainer.NewQuery(recordType).AddAscending("_created_at")
+	it := skycontainer.NewRecordIterator(db, query, queryPageSize)
+	for it.Next() {
+		record := it.Record()
+		meta := takeRecordMeta(record)
+		err = record.PostDownloadHandle()
+		if err != nil {
+			warn(err)
+			continue
+		}
+		for key, value := range meta {
+			record.Data[key] = value
+		}
+
+		err = downloadAssetsTo(db, record, assetDir, assetPathPrefix)
+		if err != nil {
+			return count, err
+		}
+
+		err = enc.Encode(record)
+		if err != nil {
+			return count, err
+		}
+		count++
+		recordProcessed()
+	}
+
+	return count, it.Err()
+}
+
+// backup writes the schema and all records in the databases to dir
+func backup(databases map[string]skycontainer.SkyDB, endpoint, dir string) (*backupManifest, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	publicDB, ok := databases["_public"]
+	if !ok {
+		return nil, fmt.Errorf("Public database is required for backup.")
+	}
+
+	schema, err := publicDB.FetchSchema()
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		schema = map[string]interface{}{}
+	}
+	err = writeJSONFile(filepath.Join(dir, backupSchemaFile), schema)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &backupManifest{
+		Version:     backupManifestVersion,
+		CreatedAt:   time.Now().UTC(),
+		Endpoint:    endpoint,
+		RecordTypes: recordTypeOrder(schema),
+		RecordCount: map[string]map[string]int{},
+	}
+
+	var databaseIDs []string
+	for databaseID := range databases {
+		databaseIDs = append(databaseIDs, databaseID)
+	}
+	sort.Strings(databaseIDs)
+
+	for _, databaseID := range databaseIDs {
+		manifest.Databases = append(manifest.Databases, databaseID)
+		manifest.RecordCount[databaseID] = map[string]int{}
+		for _, recordType := range manifest.RecordTypes {
+			count, err := backupRecords(databases[databaseID], databaseID, recordType, dir)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to back up %s in %s: %s", recordType, databaseID, err)
+			}
+			manifest.RecordCount[databaseID][recordType] = count
+		}
+	}
+
+	manifest.Files, err = checksumDirectory(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeJSONFile(filepath.Join(dir, backupManifestFile), manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// readBackup reads the manifest of the backup in dir and verifies the
+// checksums of the backup files
+func readBackup(dir string) (*backupManifest, error) {
+	manifest := &backupManifest{}
+	err := readJSONFile(filepath.Join(dir, backupManifestFile), manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.Version != backupManifestVersion {
+		return nil, fmt.Errorf("Unsupported backup version: %d", manifest.Version)
+	}
+
+	for path, expected := range manifest.Files {
+		checksum, err := fileChecksum(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+		if checksum != expected {
+			return nil, fmt.Errorf("Backup file %s is corrupted: checksum mismatch.", path)
+		}
+	}
+	return manifest, nil
+}
+
+// createMissingColumns creates the columns in schema that do not exist in
+// db, and returns the created columns in the form <record_type>.<column>
+func createMissingColumns(db skycontainer.SkyDB, schema map[string]interface{}, recordTypes []string) ([]string, error) {
+	currentSchema, err := db.FetchSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+
+	for _, recordType := range recordTypes {
+		existing := map[string]bool{}
+		for _, field := range schemaFields(currentSchema, recordType) {
+			name, _ := field["name"].(string)
+			existing[name] = true
+		}
+
+		for _, field := range schemaFields(schema, recordType) {
+			name, _ := field["name"].(string)
+			fieldType, _ := field["type"].(string)
+			if name == "" || existing[name] {
+				continue
+			}
+
+			err = db.CreateColumn(recordType, name, fieldType)
+			if err != nil {
+				return created, fmt.Errorf("Unable to create column %s of %s: %s", name, recordType, err)
+			}
+			created = append(created, recordType+"."+name)
+		}
+	}
+	return created, nil
+}
+
+// restoreRecords saves all records in the records file to db in batches
+// of importBatchSize, uploading the assets in the backup, and returns the
+// numbers of records saved and failed. Complex values are not converted
+// since the records are already in the server format. ACLs and owners of
+// records are restored only if restoreMeta is true.
+func restoreRecords(db skycontainer.SkyDB, path string, restoreMeta bool) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	recordDir := filepath.Dir(path)
+	saved, failed := 0, 0
+	var batch []*skyrecord.Record
+
+	saveBatch := func() {
+		if len(batch) == 0 {
+			return
+		}
+		defer func() {
+			batch = nil
+		}()
+
+		errs, err := db.SaveRecords(batch)
+		if err != nil {
+			warn(fmt.Errorf("Unable to save %d records: %s", len(batch), err))
+			failed += len(batch)
+			return
+		}
+		for _, err := range errs {
+			if err != nil {
+				warn(err)
+				failed++
+				continue
+			}
+			saved++
+			recordProcessed()
+		}
+	}
+
+	for record := range getRecordList(f) {
+		meta := takeRecordMeta(record)
+		err = record.PreUploadValidate()
+		if err == nil {
+			err = uploadAssets(db, record, recordDir)
+		}
+		if err != nil {
+			warn(fmt.Errorf("Record %s: %s", record.RecordID, err))
+			failed++
+			continue
+		}
+
+		if restoreMeta {
+			for key, value := range meta {
+				record.Data[key] = value
+			}
+		}
+
+		batch = append(batch, record)
+		if len(batch) >= importBatchSize {
+			saveBatch()
+		}
+	}
+	saveBatch()
+	return saved, failed, nil
+}
+
+// restore recreates the schema and records in the backup in dir. ACLs and
+// owners of records are restored only if restoreMeta is true, which
+// requires master key.
+func restore(databases map[string]skycontainer.SkyDB, dir string, restoreMeta bool) error {
+	manifest, err := readBackup(dir)
+	if err != nil {
+		return err
+	}
+
+	schema := map[string]interface{}{}
+	err = readJSONFile(filepath.Join(dir, backupSchemaFile), &schema)
+	if err != nil {
+		return err
+	}
+
+	publicDB, ok := databases["_public"]
+	if !ok {
+		return fmt.Errorf("Public database is required for restore.")
+	}
+	_, err = createMissingColumns(publicDB, schema, manifest.RecordTypes)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, databaseID := range manifest.Databases {
+		db, ok := databases[databaseID]
+		if !ok {
+			warn(fmt.Errorf("Skipped records in %s.", databaseID))
+			continue
+		}
+
+		for _, recordType := range manifest.RecordTypes {
+			path := recordsFilePath(dir, databaseID, recordType)
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				continue
+			}
+
+			count, failedCount, err := restoreRecords(db, path, restoreMeta)
+			if err != nil {
+				return err
+			}
+			failed += failedCount
+			fmt.Printf("Restored %d of %d records of %s in %s\n",
+				count, manifest.RecordCount[databaseID][recordType], recordType, databaseID)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Unable to restore %d records.", failed)
+	}
+	return nil
+}
+
+// backupDatabases returns the databases involved in backup and restore
+func backupDatabases() map[string]skycontainer.SkyDB {
+	c := newContainer()
+	databases := map[string]skycontainer.SkyDB{
+		c.PublicDatabaseID(): &skycontainer.Database{
+			Container:  c,
+			DatabaseID: c.PublicDatabaseID(),
+			Context:    databaseContext(),
+		},
+	}
+	if backupIncludePrivate {
+		databases[c.PrivateDatabaseID()] = &skycontainer.Database{
+			Container:  c,
+			DatabaseID: c.PrivateDatabaseID(),
+			Context:    databaseContext(),
+		}
+	}
+	return databases
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <dir>",
+	Short: "Back up schema, records and assets to a directory",
+	Long: `The schema, all records and their assets are saved to the directory, together with a manifest
+containing the checksums of the saved files. The backup can be restored by "restore".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMinArgCount(cmd, args, 1)
+		checkMaxArgCount(cmd, args, 1)
+
+		manifest, err := backup(backupDatabases(), Config.Endpoint, args[0])
+		if err != nil {
+			fatal(err)
+		}
+
+		for _, databaseID := range manifest.Databases {
+			total := 0
+			for _, count := range manifest.RecordCount[databaseID] {
+				total += count
+			}
+			fmt.Printf("Backed up %d records of %d record types in %s\n",
+				total, len(manifest.RecordTypes), databaseID)
+		}
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <dir>",
+	Short: "Restore schema, records and assets from a backup directory",
+	Long: `Missing columns in the schema are created before the records are saved. Records of a record type
+are saved after the records of the record types it references.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMinArgCount(cmd, args, 1)
+		checkMaxArgCount(cmd, args, 1)
+
+		warnMasterKeyUsage(Config)
+		if Config.MasterKey == "" {
+			warn(fmt.Errorf("ACLs and owners of records are not restored without master key."))
+		}
+		err := restore(backupDatabases(), args[0], Config.MasterKey != "")
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+func init() {
+	backupCmd.Flags().BoolVarP(&backupIncludePrivate, "private", "p", false, "Also back up the private database of the current user")
+	backupCmd.Flags().IntVar(&queryPageSize, "page-size", skycontainer.DefaultPageSize, "Number of records to query in each page")
+
+	restoreCmd.Flags().BoolVarP(&backupIncludePrivate, "private", "p", false, "Also restore the private database of the current user")
+	restoreCmd.Flags().IntVar(&importBatchSize, "batch-size", 50, "Number of records to save in each request")
+}
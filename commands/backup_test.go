@@ -0,0 +1,143 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	fake "github.com/skygeario/skycli/container/fakecontainer"
+	skyrecord "github.com/skygeario/skycli/record"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecordTypeOrder(t *testing.T) {
+	Convey("Record type order", t, func() {
+		schema := map[string]interface{}{
+			"a": map[string]interface{}{"fields": []interface{}{
+				map[string]interface{}{"name": "c", "type": "ref(c)"},
+			}},
+			"b": map[string]interface{}{"fields": []interface{}{
+				map[string]interface{}{"name": "name", "type": "string"},
+			}},
+			"c": map[string]interface{}{"fields": []interface{}{
+				map[string]interface{}{"name": "b", "type": "ref(b)"},
+				map[string]interface{}{"name": "a", "type": "ref(a)"},
+			}},
+		}
+
+		So(recordTypeOrder(schema), ShouldResemble, []string{"b", "c", "a"})
+	})
+}
+
+func TestBackupRestore(t *testing.T) {
+	Convey("Backup and restore", t, func() {
+		skipAsset = false
+		assetBaseDirectory = ""
+
+		db := fake.NewFakeDatabase()
+		So(db.CreateColumn("city", "name", "string"), ShouldBeNil)
+		So(db.CreateColumn("city", "image", "asset"), ShouldBeNil)
+		So(db.CreateColumn("student", "city", "ref(city)"), ShouldBeNil)
+		db.AssetList["asset-hongkong.jpg"] = []byte("hongkong")
+
+		for _, data := range []map[string]interface{}{
+			{
+				"_id":  "city/hongkong",
+				"name": "Hong Kong",
+				"image": map[string]interface{}{
+					"$type": "asset",
+					"$name": "asset-hongkong.jpg",
+					"$url":  "asset-hongkong.jpg",
+				},
+			},
+			{
+				"_id":      "student/alice",
+				"_access":  []interface{}{map[string]interface{}{"public": true, "level": "read"}},
+				"_ownerID": "alice",
+				"city":     map[string]interface{}{"$type": "ref", "$id": "city/hongkong"},
+			},
+		} {
+			record, _ := skyrecord.MakeRecord(data)
+			So(db.SaveRecord(record), ShouldBeNil)
+		}
+
+		dir, err := ioutil.TempDir("", "skycli")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		manifest, err := backup(map[string]skycontainer.SkyDB{"_public": db}, "http://localhost:3000/", dir)
+		So(err, ShouldBeNil)
+		So(manifest.RecordTypes, ShouldResemble, []string{"city", "student"})
+		So(manifest.RecordCount["_public"], ShouldResemble, map[string]int{"city": 1, "student": 1})
+		So(manifest.Files, ShouldContainKey, "assets/asset-hongkong.jpg")
+
+		Convey("restores to another database", func() {
+			newDB := fake.NewFakeDatabase()
+			err := restore(map[string]skycontainer.SkyDB{"_public": newDB}, dir, true)
+			So(err, ShouldBeNil)
+
+			So(newDB.Schema, ShouldResemble, db.Schema)
+
+			city := newDB.RecordList["city"]["hongkong"]
+			So(city, ShouldNotBeNil)
+			image, ok := city.Data["image"].(map[string]interface{})
+			So(ok, ShouldBeTrue)
+			So(image["$type"], ShouldEqual, "asset")
+
+			student := newDB.RecordList["student"]["alice"]
+			So(student, ShouldNotBeNil)
+			So(student.Data["city"], ShouldResemble, map[string]interface{}{"$type": "ref", "$id": "city/hongkong"})
+			So(student.Data["_ownerID"], ShouldEqual, "alice")
+			So(student.Data["_access"], ShouldResemble, []interface{}{map[string]interface{}{"public": true, "level": "read"}})
+		})
+
+		Convey("restores without ACLs and owners", func() {
+			newDB := fake.NewFakeDatabase()
+			err := restore(map[string]skycontainer.SkyDB{"_public": newDB}, dir, false)
+			So(err, ShouldBeNil)
+
+			student := newDB.RecordList["student"]["alice"]
+			So(student, ShouldNotBeNil)
+			So(student.Data, ShouldNotContainKey, "_ownerID")
+			So(student.Data, ShouldNotContainKey, "_access")
+		})
+
+		Convey("counts records failed to restore", func() {
+			path := filepath.Join(dir, "student.json")
+			So(ioutil.WriteFile(path, []byte(`{"_id":"student/bob"}
+{"_id":"student/carol","_secret":"x"}
+`), 0644), ShouldBeNil)
+
+			newDB := fake.NewFakeDatabase()
+			saved, failed, err := restoreRecords(newDB, path, false)
+			So(err, ShouldBeNil)
+			So(saved, ShouldEqual, 1)
+			So(failed, ShouldEqual, 1)
+			So(newDB.RecordList["student"], ShouldContainKey, "bob")
+		})
+
+		Convey("refuses to restore corrupted backup", func() {
+			path := filepath.Join(dir, "records", "_public", "city.json")
+			So(ioutil.WriteFile(path, []byte("{}"), 0644), ShouldBeNil)
+
+			err := restore(map[string]skycontainer.SkyDB{"_public": fake.NewFakeDatabase()}, dir, false)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -19,14 +19,62 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	skyrecord "github.com/skygeario/skycli/record"
 )
 
+// dateTimezone is the name of the time zone of dates without an offset
+var dateTimezone string
+
+// shorthandOutput tells whether complex values in the output are rendered
+// in their simpler form
+var shorthandOutput bool
+
 // ComplexTypeList provide the list of available complex type
-var ComplexTypeList []complexType
+var ComplexTypeList []ComplexType
 
-type complexType interface {
+// ComplexType converts the simpler form of a complex value, such as
+// @loc:<lat>,<lng>, to the value saved to Skygear and back
+type ComplexType interface {
+	// Validate returns whether the string is in the simpler form of the
+	// complex type
 	Validate(string) bool
+	// Convert converts the simpler form to the value saved to Skygear
 	Convert(string) (interface{}, error)
+	// Render returns the simpler form of the value, and whether the value
+	// is of the complex type
+	Render(interface{}) (string, bool)
+}
+
+// RegisterComplexType adds a complex type, which is converted in records
+// imported or set, and rendered with --shorthand. Complex types are tried
+// in the order they are registered.
+func RegisterComplexType(complexType ComplexType) {
+	ComplexTypeList = append(ComplexTypeList, complexType)
+}
+
+// complexValueType returns the $type of the value if it is a complex value
+func complexValueType(value interface{}) (map[string]interface{}, string) {
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, ""
+	}
+	valueType, _ := valueMap["$type"].(string)
+	return valueMap, valueType
+}
+
+// renderComplexValues replaces the complex values of the record with their
+// simpler forms, so that the record can be imported again
+func renderComplexValues(record *skyrecord.Record) {
+	for key, value := range record.Data {
+		for _, complexType := range ComplexTypeList {
+			if rendered, ok := complexType.Render(value); ok {
+				record.Data[key] = rendered
+				break
+			}
+		}
+	}
 }
 
 // Location
@@ -68,6 +116,19 @@ func (s *complexLocation) Convert(valStr string) (interface{}, error) {
 	return loc, nil
 }
 
+func (s *complexLocation) Render(value interface{}) (string, bool) {
+	loc, valueType := complexValueType(value)
+	if valueType != "geo" {
+		return "", false
+	}
+	lat, latOK := loc["$lat"].(float64)
+	lng, lngOK := loc["$lng"].(float64)
+	if !latOK || !lngOK {
+		return "", false
+	}
+	return "@loc:" + strconv.FormatFloat(lat, 'f', -1, 64) + "," + strconv.FormatFloat(lng, 'f', -1, 64), true
+}
+
 // Reference
 type complexReference struct {
 	validRegexp *regexp.Regexp
@@ -94,6 +155,15 @@ func (s *complexReference) Convert(valStr string) (interface{}, error) {
 	return ref, nil
 }
 
+func (s *complexReference) Render(value interface{}) (string, bool) {
+	ref, valueType := complexValueType(value)
+	id, ok := ref["$id"].(string)
+	if valueType != "ref" || !ok {
+		return "", false
+	}
+	return "@ref:" + id, true
+}
+
 // String
 type complexString struct {
 	validRegexp *regexp.Regexp
@@ -120,8 +190,126 @@ func (s *complexString) Convert(valStr string) (interface{}, error) {
 	return strMap, nil
 }
 
+// Render renders strings which would be taken as simpler forms of complex
+// values when imported, so that they are imported as strings
+func (s *complexString) Render(value interface{}) (string, bool) {
+	if str, ok := value.(string); ok {
+		if strings.HasPrefix(str, "@") {
+			return "@str:" + str, true
+		}
+		return "", false
+	}
+
+	strMap, valueType := complexValueType(value)
+	str, ok := strMap["$str"].(string)
+	if valueType != "str" || !ok {
+		return "", false
+	}
+	return "@str:" + str, true
+}
+
+// Date
+type complexDate struct {
+	validRegexp    *regexp.Regexp
+	relativeRegexp *regexp.Regexp
+	now            func() time.Time
+}
+
+func newComplexDate() *complexDate {
+	return &complexDate{
+		validRegexp:    regexp.MustCompile("^@date:"),
+		relativeRegexp: regexp.MustCompile(`^([+-])(\d+)([smhdw])$`),
+		now:            time.Now,
+	}
+}
+
+// dateUnits are the units of relative dates
+var dateUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+func (s *complexDate) Validate(valStr string) bool {
+	return s.validRegexp.MatchString(valStr)
+}
+
+// location returns the time zone of dates without an offset
+func (s *complexDate) location() (*time.Location, error) {
+	if dateTimezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(dateTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown time zone %s.", dateTimezone)
+	}
+	return loc, nil
+}
+
+func (s *complexDate) parse(str string) (time.Time, error) {
+	if str == "now" {
+		return s.now(), nil
+	}
+
+	if match := s.relativeRegexp.FindStringSubmatch(str); match != nil {
+		amount, err := strconv.Atoi(match[2])
+		if err != nil {
+			return time.Time{}, err
+		}
+		offset := time.Duration(amount) * dateUnits[match[3]]
+		if match[1] == "-" {
+			offset = -offset
+		}
+		return s.now().Add(offset), nil
+	}
+
+	if date, err := time.Parse(time.RFC3339Nano, str); err == nil {
+		return date, nil
+	}
+
+	loc, err := s.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04", "2006-01-02"} {
+		if date, err := time.ParseInLocation(layout, str, loc); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Wrong format of complex value(date). Expected RFC3339, YYYY-MM-DD, now or relative time such as -7d.")
+}
+
+func (s *complexDate) Convert(valStr string) (interface{}, error) {
+	if s.Validate(valStr) == false {
+		return "", fmt.Errorf("Unexpected complex date")
+	}
+
+	date, err := s.parse(s.validRegexp.ReplaceAllString(valStr, ""))
+	if err != nil {
+		return "", err
+	}
+
+	dateMap := map[string]interface{}{
+		"$type": "date",
+		"$date": date.UTC().Format(time.RFC3339Nano),
+	}
+	return dateMap, nil
+}
+
+func (s *complexDate) Render(value interface{}) (string, bool) {
+	date, valueType := complexValueType(value)
+	str, ok := date["$date"].(string)
+	if valueType != "date" || !ok {
+		return "", false
+	}
+	return "@date:" + str, true
+}
+
 func init() {
-	ComplexTypeList = append(ComplexTypeList, newComplexLocation())
-	ComplexTypeList = append(ComplexTypeList, newComplexReference())
-	ComplexTypeList = append(ComplexTypeList, newComplexString())
+	RegisterComplexType(newComplexLocation())
+	RegisterComplexType(newComplexReference())
+	RegisterComplexType(newComplexString())
+	RegisterComplexType(newComplexDate())
 }
@@ -16,8 +16,11 @@ package commands
 
 import (
 	"testing"
+	"time"
 
+	skyrecord "github.com/skygeario/skycli/record"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
 )
 
 func TestLocationValidate(t *testing.T) {
@@ -144,3 +147,177 @@ func TestStringConvert(t *testing.T) {
 		})
 	})
 }
+
+func TestDateConvert(t *testing.T) {
+	Convey("Complex Date", t, func() {
+		date := newComplexDate()
+		date.now = func() time.Time {
+			return time.Date(2016, 3, 10, 12, 0, 0, 0, time.UTC)
+		}
+		defer func() {
+			dateTimezone = ""
+		}()
+
+		convert := func(input string) interface{} {
+			output, err := date.Convert(input)
+			So(err, ShouldBeNil)
+			return output.(map[string]interface{})["$date"]
+		}
+
+		Convey("validates date", func() {
+			So(date.Validate("@date:2016-03-10"), ShouldBeTrue)
+			So(date.Validate("2016-03-10"), ShouldBeFalse)
+		})
+
+		Convey("gets RFC3339 date", func() {
+			output, err := date.Convert("@date:2016-03-10T12:30:00+08:00")
+			So(err, ShouldBeNil)
+			So(output, ShouldResemble, map[string]interface{}{
+				"$type": "date",
+				"$date": "2016-03-10T04:30:00Z",
+			})
+		})
+
+		Convey("gets date in time zone", func() {
+			dateTimezone = "Asia/Hong_Kong"
+			So(convert("@date:2016-03-10"), ShouldEqual, "2016-03-09T16:00:00Z")
+			So(convert("@date:2016-03-10T12:30:00"), ShouldEqual, "2016-03-10T04:30:00Z")
+
+			dateTimezone = "UTC"
+			So(convert("@date:2016-03-10"), ShouldEqual, "2016-03-10T00:00:00Z")
+		})
+
+		Convey("gets relative date", func() {
+			So(convert("@date:now"), ShouldEqual, "2016-03-10T12:00:00Z")
+			So(convert("@date:-7d"), ShouldEqual, "2016-03-03T12:00:00Z")
+			So(convert("@date:+2h"), ShouldEqual, "2016-03-10T14:00:00Z")
+		})
+
+		Convey("gets invalid date", func() {
+			_, err := date.Convert("@date:yesterday")
+			So(err, ShouldNotBeNil)
+
+			dateTimezone = "Nowhere/Unknown"
+			_, err = date.Convert("@date:2016-03-10")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRenderComplexValues(t *testing.T) {
+	Convey("Render complex values", t, func() {
+		record, _ := skyrecord.MakeRecord(map[string]interface{}{
+			"_id":      "note/1",
+			"location": map[string]interface{}{"$type": "geo", "$lat": 3.14, "$lng": 2.0},
+			"parent":   map[string]interface{}{"$type": "ref", "$id": "note/0"},
+			"created":  map[string]interface{}{"$type": "date", "$date": "2016-03-10T04:30:00Z"},
+			"literal":  "@loc:1,2",
+			"text":     "hello",
+			"meta":     map[string]interface{}{"x": 1},
+			"asset":    map[string]interface{}{"$type": "asset", "$name": "a.txt"},
+		})
+
+		renderComplexValues(record)
+		So(record.Data, ShouldResemble, map[string]interface{}{
+			"location": "@loc:3.14,2",
+			"parent":   "@ref:note/0",
+			"created":  "@date:2016-03-10T04:30:00Z",
+			"literal":  "@str:@loc:1,2",
+			"text":     "hello",
+			"meta":     map[string]interface{}{"x": 1},
+			"asset":    map[string]interface{}{"$type": "asset", "$name": "a.txt"},
+		})
+
+		Convey("which are converted back", func() {
+			forceConvertComplexValue = true
+			defer func() {
+				forceConvertComplexValue = false
+			}()
+
+			So(convertComplexValue(record), ShouldBeNil)
+			So(record.Data["location"], ShouldResemble, map[string]interface{}{"$type": "geo", "$lat": 3.14, "$lng": 2.0})
+			So(record.Data["parent"], ShouldResemble, map[string]interface{}{"$type": "ref", "$id": "note/0"})
+			So(record.Data["created"], ShouldResemble, map[string]interface{}{"$type": "date", "$date": "2016-03-10T04:30:00Z"})
+			So(record.Data["literal"], ShouldResemble, map[string]interface{}{"$type": "str", "$str": "@loc:1,2"})
+		})
+	})
+}
+
+func TestCustomComplexType(t *testing.T) {
+	Convey("Custom complex type", t, func() {
+		money, err := newCustomComplexType("money", map[string]string{
+			"prefix":   "@money:",
+			"pattern":  `^(?P<amount>\d+(\.\d+)?) (?P<currency>[A-Z]{3})$`,
+			"template": `{"amount": {{mul .amount 100 | round}}, "currency": {{json .currency}}}`,
+			"render":   `{{printf "%.2f" (div .amount 100)}} {{.currency}}`,
+		})
+		So(err, ShouldBeNil)
+
+		Convey("converts value", func() {
+			So(money.Validate("@money:12.50 USD"), ShouldBeTrue)
+			So(money.Validate("12.50 USD"), ShouldBeFalse)
+
+			output, err := money.Convert("@money:12.50 USD")
+			So(err, ShouldBeNil)
+			So(output, ShouldResemble, map[string]interface{}{
+				"amount":   float64(1250),
+				"currency": "USD",
+			})
+
+			_, err = money.Convert("@money:12.50")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("renders value", func() {
+			rendered, ok := money.Render(map[string]interface{}{
+				"amount":   float64(1250),
+				"currency": "USD",
+			})
+			So(ok, ShouldBeTrue)
+			So(rendered, ShouldEqual, "@money:12.50 USD")
+
+			_, ok = money.Render(map[string]interface{}{"x": 1})
+			So(ok, ShouldBeFalse)
+			_, ok = money.Render("12.50 USD")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("gets invalid config", func() {
+			_, err := newCustomComplexType("money", map[string]string{"template": "{}"})
+			So(err, ShouldNotBeNil)
+			_, err = newCustomComplexType("money", map[string]string{"prefix": "@money:", "template": "{{"})
+			So(err, ShouldNotBeNil)
+			_, err = newCustomComplexType("money", map[string]string{"prefix": "@money:", "template": "{}", "pattern": "("})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("is registered from config", func() {
+			viper.Set("complex_type", map[string]interface{}{
+				"money": map[string]interface{}{
+					"prefix":   "@money:",
+					"template": `{"text": {{json .value}}}`,
+				},
+			})
+			defer func() {
+				viper.Set("complex_type", nil)
+				So(loadConfigComplexTypes(), ShouldBeNil)
+			}()
+
+			count := len(ComplexTypeList)
+			So(loadConfigComplexTypes(), ShouldBeNil)
+			So(loadConfigComplexTypes(), ShouldBeNil)
+			So(ComplexTypeList, ShouldHaveLength, count+1)
+
+			record, _ := skyrecord.MakeRecord(map[string]interface{}{
+				"_id":   "order/1",
+				"price": "@money:12.50 USD",
+			})
+			forceConvertComplexValue = true
+			defer func() {
+				forceConvertComplexValue = false
+			}()
+			So(convertComplexValue(record), ShouldBeNil)
+			So(record.Data["price"], ShouldResemble, map[string]interface{}{"text": "12.50 USD"})
+		})
+	})
+}
@@ -17,19 +17,70 @@ package commands
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 )
 
 type config struct {
 	AccessToken string `mapstructure:"access_token"`
 	APIKey      string `mapstructure:"api_key"`
+	MasterKey   string `mapstructure:"master_key"`
 	Endpoint    string `mapstructure:"endpoint"`
+
+	// Production marks the server as a production server, which warns
+	// about modification with master key
+	Production bool `mapstructure:"production"`
+}
+
+// value returns the config value of a key in the config file
+func (c *config) value(key string) string {
+	switch key {
+	case "access_token":
+		return c.AccessToken
+	case "api_key":
+		return c.APIKey
+	case "master_key":
+		return c.MasterKey
+	case "endpoint":
+		return c.Endpoint
+	case "production":
+		return strconv.FormatBool(c.Production)
+	}
+	return ""
+}
+
+// setValue sets the config value of a key in the config file
+func (c *config) setValue(key, value string) {
+	switch key {
+	case "access_token":
+		c.AccessToken = value
+	case "api_key":
+		c.APIKey = value
+	case "master_key":
+		c.MasterKey = value
+	case "endpoint":
+		c.Endpoint = value
+	case "production":
+		c.Production = cast.ToBool(value)
+	}
 }
 
 var Config config
 
+// configFileUsed is the path of the config file read, if any
+var configFileUsed string
+
+// baseConfig is the config before the values of the current profile
+// are applied
+var baseConfig config
+
+const localConfigLocation = ".skycli/config"
+
 func loadDefaultConfig() {
 	viper.SetDefault("endpoint", "http://localhost:3000/")
 }
@@ -42,21 +93,33 @@ func defaultConfigLocation() string {
 	return path
 }
 
-func LoadConfigFile() {
-	loadDefaultConfig()
-
+// findConfigFile returns the config file to be used. The project-local
+// config file in the working directory takes precedence over the
+// default config file in the home directory.
+func findConfigFile() string {
 	configFile := viper.GetString("config")
-	// If config is not set in flag, try the default config location
-	if configFile == "" {
-		defaultConfigFile := defaultConfigLocation()
+	if configFile != "" {
+		return configFile
+	}
 
-		if _, err := os.Stat(defaultConfigFile); err == nil {
-			configFile = defaultConfigFile
+	for _, path := range []string{localConfigLocation, defaultConfigLocation()} {
+		if _, err := os.Stat(path); err == nil {
+			return path
 		}
 	}
+	return ""
+}
 
+func LoadConfigFile() {
+	loadDefaultConfig()
+
+	configFile := findConfigFile()
+	configFileUsed = configFile
 	if configFile != "" {
 		viper.SetConfigFile(configFile)
+		if filepath.Ext(configFile) == "" {
+			viper.SetConfigType("toml")
+		}
 		err := viper.ReadInConfig()
 		if err != nil {
 			fatal(fmt.Errorf("Unable to read config file: %s \n", err))
@@ -67,4 +130,65 @@ func LoadConfigFile() {
 	if err != nil {
 		fatal(err)
 	}
+	baseConfig = Config
+
+	err = loadConfigComplexTypes()
+	if err != nil {
+		fatal(err)
+	}
+
+	if profile := currentProfile(); profile != "" {
+		values, err := profileValues(profile)
+		if err != nil {
+			fatal(err)
+		}
+		for key, value := range values {
+			if !overriddenByUser(key) {
+				Config.setValue(key, value)
+			}
+		}
+	}
+}
+
+// currentProfile returns the name of the profile in use, which is set by
+// the --profile flag, the SKYCLI_PROFILE environment variable or
+// current_profile in the config file.
+func currentProfile() string {
+	return viper.GetString("current_profile")
+}
+
+// overriddenByUser returns whether the config key is set by flag or
+// environment variable, which take precedence over the current profile
+func overriddenByUser(key string) bool {
+	if flag := globalFlags.Lookup(key); flag != nil && flag.Changed {
+		return true
+	}
+	_, ok := os.LookupEnv("SKYCLI_" + strings.ToUpper(key))
+	return ok
+}
+
+// profileValues returns the config values of the named profile, which is
+// the [profile.<name>] section in the config file
+func profileValues(name string) (map[string]string, error) {
+	profiles := viper.GetStringMap("profile")
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("Profile %s not found in config file.", name)
+	}
+	return cast.ToStringMapString(profile), nil
+}
+
+// profileConfig returns the config of the named profile. Keys not set in
+// the profile are taken from the top level of the config file.
+func profileConfig(name string) (config, error) {
+	values, err := profileValues(name)
+	if err != nil {
+		return config{}, err
+	}
+
+	cfg := baseConfig
+	for key, value := range values {
+		cfg.setValue(key, value)
+	}
+	return cfg, nil
 }
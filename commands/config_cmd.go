@@ -0,0 +1,432 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	skycontainer "github.com/skygeario/skycli/container"
+	"github.com/spf13/cobra"
+)
+
+var configInitLocal bool
+var configNoProfile bool
+
+// configKeys are the keys that can be managed by the config command
+var configKeys = []string{"endpoint", "api_key", "master_key", "access_token", "production"}
+
+// secretConfigKeys are masked when config values are listed
+var secretConfigKeys = map[string]bool{
+	"api_key":      true,
+	"master_key":   true,
+	"access_token": true,
+}
+
+func checkConfigKey(key string) error {
+	if key == "current_profile" {
+		return nil
+	}
+	for _, configKey := range configKeys {
+		if key == configKey {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown config key %s.", key)
+}
+
+// maskSecret hides all but the last few characters of the value
+func maskSecret(value string) string {
+	if len(value) <= 8 {
+		return strings.Repeat("*", len(value))
+	}
+	return "****" + value[len(value)-4:]
+}
+
+// configFileToWrite returns the config file to be modified, which is the
+// config file in use or the default config file if there is none
+func configFileToWrite() string {
+	if configFileUsed != "" {
+		return configFileUsed
+	}
+	return defaultConfigLocation()
+}
+
+// readConfigData reads the content of the config file. An empty config is
+// returned if the file does not exist.
+func readConfigData(path string) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return data, nil
+	}
+
+	_, err := toml.DecodeFile(path, &data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read config file: %s", err)
+	}
+	return data, nil
+}
+
+// writeConfigData writes the content to the config file. The file is
+// readable by the owner only because it contains credentials.
+func writeConfigData(path string, data map[string]interface{}) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return toml.NewEncoder(f).Encode(data)
+}
+
+// configProfiles returns the names of the profiles in the config content
+func configProfiles(data map[string]interface{}) []string {
+	profiles, _ := data["profile"].(map[string]interface{})
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configSection returns the part of the config content that the key of
+// the profile belongs to. The top level is returned if profile is empty.
+func configSection(data map[string]interface{}, profile, key string, create bool) map[string]interface{} {
+	if profile == "" || key == "current_profile" {
+		return data
+	}
+
+	profiles, ok := data["profile"].(map[string]interface{})
+	if !ok {
+		if !create {
+			return nil
+		}
+		profiles = map[string]interface{}{}
+		data["profile"] = profiles
+	}
+
+	section, ok := profiles[profile].(map[string]interface{})
+	if !ok {
+		if !create {
+			return nil
+		}
+		section = map[string]interface{}{}
+		profiles[profile] = section
+	}
+	return section
+}
+
+// setConfigValue sets the value of the key in the config content
+func setConfigValue(data map[string]interface{}, profile, key, value string) {
+	configSection(data, profile, key, true)[key] = value
+}
+
+// unsetConfigValue removes the key from the config content
+func unsetConfigValue(data map[string]interface{}, profile, key string) {
+	if section := configSection(data, profile, key, false); section != nil {
+		delete(section, key)
+	}
+}
+
+// editingProfile returns the profile modified by config commands
+func editingProfile() string {
+	if configNoProfile {
+		return ""
+	}
+	return currentProfile()
+}
+
+// updateConfigFile reads the config file, applies update and writes the
+// result back
+func updateConfigFile(update func(data map[string]interface{}) error) (string, error) {
+	path := configFileToWrite()
+	data, err := readConfigData(path)
+	if err != nil {
+		return path, err
+	}
+
+	err = update(data)
+	if err != nil {
+		return path, err
+	}
+	return path, writeConfigData(path, data)
+}
+
+// effectiveConfigValue returns the value of the key in use
+func effectiveConfigValue(key string) string {
+	if key == "current_profile" {
+		return currentProfile()
+	}
+	return Config.value(key)
+}
+
+// validateServer checks that the server at the endpoint accepts the
+// API key and access token
+func validateServer(cfg config) error {
+	c := newContainerWithConfig(cfg)
+	response, err := c.MakeRequest("me", &skycontainer.GenericRequest{
+		Payload: map[string]interface{}{},
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s: %s", cfg.Endpoint, err)
+	}
+
+	if !response.IsError() {
+		return nil
+	}
+
+	switch response.Error().Code {
+	case skycontainer.AccessKeyNotAccepted:
+		return errors.New("API key is not accepted by the server.")
+	case skycontainer.AccessTokenNotAccepted:
+		if cfg.AccessToken != "" {
+			return errors.New("Access token is not accepted by the server.")
+		}
+	}
+	return nil
+}
+
+// promptValue asks for a value, returning defaultValue if the answer is
+// empty. displayValue is shown in place of the default value.
+func promptValue(r *bufio.Reader, label, defaultValue, displayValue string) (string, error) {
+	if displayValue != "" {
+		fmt.Printf("%s [%s]: ", label, displayValue)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return defaultValue, nil
+	}
+	return line, nil
+}
+
+// promptConfig asks for the config values interactively
+func promptConfig(r *bufio.Reader, cfg config) (config, error) {
+	var err error
+	cfg.Endpoint, err = promptValue(r, "Endpoint", cfg.Endpoint, cfg.Endpoint)
+	if err != nil {
+		return cfg, err
+	}
+	if !strings.HasSuffix(cfg.Endpoint, "/") {
+		cfg.Endpoint += "/"
+	}
+
+	cfg.APIKey, err = promptValue(r, "API key", cfg.APIKey, maskSecret(cfg.APIKey))
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.AccessToken, err = promptValue(r, "Access token (optional)", cfg.AccessToken, maskSecret(cfg.AccessToken))
+	return cfg, err
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage skycli settings",
+	Long: `Manage settings in the config file. Values are set in the current profile
+if there is one, unless --no-profile is specified.`,
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create config file interactively",
+	Run: func(cmd *cobra.Command, args []string) {
+		r := bufio.NewReader(os.Stdin)
+		cfg, err := promptConfig(r, Config)
+		if err != nil {
+			fatal(err)
+		}
+
+		err = validateServer(cfg)
+		if err != nil {
+			warn(err)
+			answer, err := promptValue(r, "Save anyway? (y or n)", "n", "")
+			if err != nil {
+				fatal(err)
+			}
+			if answer[0] != 'y' && answer[0] != 'Y' {
+				os.Exit(1)
+			}
+		}
+
+		path := configFileToWrite()
+		if configInitLocal {
+			path = localConfigLocation
+		}
+
+		data, err := readConfigData(path)
+		if err != nil {
+			fatal(err)
+		}
+		profile := editingProfile()
+		for _, key := range []string{"endpoint", "api_key", "access_token"} {
+			if value := cfg.value(key); value != "" {
+				setConfigValue(data, profile, key, value)
+			} else {
+				unsetConfigValue(data, profile, key)
+			}
+		}
+
+		err = writeConfigData(path, data)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Config written to %s.\n", path)
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the value of a setting in use",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMinArgCount(cmd, args, 1)
+		checkMaxArgCount(cmd, args, 1)
+
+		err := checkConfigKey(args[0])
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(effectiveConfigValue(args[0]))
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set the value of a setting in the config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMinArgCount(cmd, args, 2)
+		checkMaxArgCount(cmd, args, 2)
+
+		key, value := args[0], args[1]
+		err := checkConfigKey(key)
+		if err != nil {
+			fatal(err)
+		}
+
+		_, err = updateConfigFile(func(data map[string]interface{}) error {
+			if key == "current_profile" && configSection(data, value, "", false) == nil {
+				return fmt.Errorf("Profile %s not found in config file.", value)
+			}
+			setConfigValue(data, editingProfile(), key, value)
+			return nil
+		})
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a setting from the config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMinArgCount(cmd, args, 1)
+		checkMaxArgCount(cmd, args, 1)
+
+		key := args[0]
+		err := checkConfigKey(key)
+		if err != nil {
+			fatal(err)
+		}
+
+		_, err = updateConfigFile(func(data map[string]interface{}) error {
+			unsetConfigValue(data, editingProfile(), key)
+			return nil
+		})
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Print the settings in use",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMaxArgCount(cmd, args, 0)
+
+		fmt.Printf("config_file = %s\n", configFileUsed)
+		fmt.Printf("current_profile = %s\n", currentProfile())
+		for _, key := range configKeys {
+			value := Config.value(key)
+			if secretConfigKeys[key] {
+				value = maskSecret(value)
+			}
+			fmt.Printf("%s = %s\n", key, value)
+		}
+
+		if configFileUsed != "" {
+			data, err := readConfigData(configFileUsed)
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Printf("profiles = %s\n", strings.Join(configProfiles(data), ", "))
+		}
+	},
+}
+
+var configUseProfileCmd = &cobra.Command{
+	Use:   "use-profile <name>",
+	Short: "Set the profile to be used by default",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMinArgCount(cmd, args, 1)
+		checkMaxArgCount(cmd, args, 1)
+
+		name := args[0]
+		path, err := updateConfigFile(func(data map[string]interface{}) error {
+			if configSection(data, name, "", false) == nil {
+				return fmt.Errorf("Profile %s not found in config file.", name)
+			}
+			setConfigValue(data, "", "current_profile", name)
+			return nil
+		})
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Using profile %s in %s.\n", name, path)
+	},
+}
+
+func init() {
+	configInitCmd.Flags().BoolVar(&configInitLocal, "local", false, "Write to the project config file in the working directory")
+	configCmd.PersistentFlags().BoolVar(&configNoProfile, "no-profile", false, "Modify the top level of the config file instead of the current profile")
+
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configUseProfileCmd)
+}
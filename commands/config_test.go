@@ -0,0 +1,161 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+const testConfig = `
+endpoint = "http://localhost:3000/"
+api_key = "local"
+
+[profile.staging]
+endpoint = "https://staging.example.com/"
+api_key = "staging"
+access_token = "staging-token"
+
+[profile.production]
+endpoint = "https://production.example.com/"
+production = true
+`
+
+func TestLoadConfigFile(t *testing.T) {
+	Convey("Load config file with profiles", t, func() {
+		dir, err := ioutil.TempDir("", "skycli")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		configFile := filepath.Join(dir, "config.toml")
+		So(ioutil.WriteFile(configFile, []byte(testConfig), 0644), ShouldBeNil)
+
+		viper.Set("config", configFile)
+		defer func() {
+			viper.Set("config", "")
+			viper.Set("current_profile", "")
+			Config = config{}
+			baseConfig = config{}
+		}()
+
+		Convey("uses top level config without profile", func() {
+			viper.Set("current_profile", "")
+			LoadConfigFile()
+			So(Config, ShouldResemble, config{
+				Endpoint: "http://localhost:3000/",
+				APIKey:   "local",
+			})
+		})
+
+		Convey("uses config of current profile", func() {
+			viper.Set("current_profile", "staging")
+			LoadConfigFile()
+			So(Config, ShouldResemble, config{
+				Endpoint:    "https://staging.example.com/",
+				APIKey:      "staging",
+				AccessToken: "staging-token",
+			})
+		})
+
+		Convey("respects environment variable over profile", func() {
+			os.Setenv("SKYCLI_API_KEY", "env")
+			defer os.Unsetenv("SKYCLI_API_KEY")
+
+			viper.Set("current_profile", "staging")
+			LoadConfigFile()
+			So(Config.Endpoint, ShouldEqual, "https://staging.example.com/")
+			So(overriddenByUser("api_key"), ShouldBeTrue)
+			So(overriddenByUser("endpoint"), ShouldBeFalse)
+		})
+
+		Convey("gets config of another profile", func() {
+			viper.Set("current_profile", "staging")
+			LoadConfigFile()
+
+			cfg, err := profileConfig("production")
+			So(err, ShouldBeNil)
+			So(cfg, ShouldResemble, config{
+				Endpoint:   "https://production.example.com/",
+				APIKey:     "local",
+				Production: true,
+			})
+
+			_, err = profileConfig("notexist")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestConfigData(t *testing.T) {
+	Convey("Config data", t, func() {
+		dir, err := ioutil.TempDir("", "skycli")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		configFile := filepath.Join(dir, "config.toml")
+		So(ioutil.WriteFile(configFile, []byte(testConfig), 0644), ShouldBeNil)
+
+		data, err := readConfigData(configFile)
+		So(err, ShouldBeNil)
+		So(configProfiles(data), ShouldResemble, []string{"production", "staging"})
+
+		Convey("sets value at top level", func() {
+			setConfigValue(data, "", "api_key", "new")
+			So(data["api_key"], ShouldEqual, "new")
+		})
+
+		Convey("sets value in profile", func() {
+			setConfigValue(data, "production", "api_key", "production")
+			setConfigValue(data, "dev", "endpoint", "http://dev.example.com/")
+			So(data["api_key"], ShouldEqual, "local")
+			So(configSection(data, "production", "api_key", false)["api_key"], ShouldEqual, "production")
+			So(configProfiles(data), ShouldResemble, []string{"dev", "production", "staging"})
+		})
+
+		Convey("sets current profile at top level", func() {
+			setConfigValue(data, "staging", "current_profile", "production")
+			So(data["current_profile"], ShouldEqual, "production")
+		})
+
+		Convey("unsets value", func() {
+			unsetConfigValue(data, "staging", "access_token")
+			unsetConfigValue(data, "notexist", "access_token")
+			So(configSection(data, "staging", "access_token", false), ShouldNotContainKey, "access_token")
+		})
+
+		Convey("writes config file", func() {
+			newFile := filepath.Join(dir, "new", "config")
+			setConfigValue(data, "staging", "api_key", "changed")
+			So(writeConfigData(newFile, data), ShouldBeNil)
+
+			newData, err := readConfigData(newFile)
+			So(err, ShouldBeNil)
+			So(newData, ShouldResemble, data)
+		})
+	})
+}
+
+func TestMaskSecret(t *testing.T) {
+	Convey("Mask secret", t, func() {
+		So(maskSecret(""), ShouldEqual, "")
+		So(maskSecret("secret"), ShouldEqual, "******")
+		So(maskSecret("my-api-key-1234"), ShouldEqual, "****1234")
+	})
+}
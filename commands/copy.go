@@ -0,0 +1,271 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	skyrecord "github.com/skygeario/skycli/record"
+	"github.com/spf13/cobra"
+)
+
+var copyFromProfile string
+var copyToProfile string
+var copySkipExisting bool
+
+// copyStats counts the records of a record type by the copy result
+type copyStats struct {
+	Created int
+	Updated int
+	Skipped int
+	Failed  int
+}
+
+// copyAssets downloads the assets of the record from src and uploads them
+// to dst. Since asset names differ between servers, the assets in the
+// record are replaced with the names given by dst.
+func copyAssets(src, dst skycontainer.SkyDB, record *skyrecord.Record, tempDir string) error {
+	for idx, val := range record.Data {
+		valMap, ok := val.(map[string]interface{})
+		if !ok || valMap["$type"] != "asset" {
+			continue
+		}
+
+		assetName, _ := valMap["$name"].(string)
+		assetURL, _ := valMap["$url"].(string)
+		if assetName == "" || assetURL == "" {
+			return fmt.Errorf("Asset in %s has no name or URL.", idx)
+		}
+
+		assetData, err := src.FetchAsset(assetURL)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(tempDir, filepath.Base(assetName))
+		err = ioutil.WriteFile(path, assetData, 0644)
+		if err != nil {
+			return err
+		}
+
+		newName, err := dst.SaveAsset(path)
+		os.Remove(path)
+		if err != nil {
+			return err
+		}
+
+		record.Data[idx] = map[string]interface{}{
+			"$type": "asset",
+			"$name": newName,
+		}
+	}
+	return nil
+}
+
+// existingRecordIDs returns the IDs of the records in recordList that
+// exist in db
+func existingRecordIDs(db skycontainer.SkyDB, recordType string, recordList []*skyrecord.Record) (map[string]bool, error) {
+	var keys []interface{}
+	for _, record := range recordList {
+		recordIDParts := strings.SplitN(record.RecordID, "/", 2)
+		keys = append(keys, recordIDParts[len(recordIDParts)-1])
+	}
+
+	query := skycontainer.NewQuery(recordType).In("_id", keys)
+	query.Limit = len(keys)
+	found, err := db.QueryRecord(query)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]bool{}
+	for _, record := range found {
+		existing[record.RecordID] = true
+	}
+	return existing, nil
+}
+
+func copyRecordBatch(src, dst skycontainer.SkyDB, recordType string, recordList []*skyrecord.Record, tempDir string, stats *copyStats) error {
+	existing, err := existingRecordIDs(dst, recordType, recordList)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range recordList {
+		if existing[record.RecordID] && copySkipExisting {
+			stats.Skipped++
+			continue
+		}
+
+		err = record.PostDownloadHandle()
+		if err == nil {
+			err = copyAssets(src, dst, record, tempDir)
+		}
+		if err == nil {
+			err = dst.SaveRecord(record)
+		}
+		if err != nil {
+			warn(fmt.Errorf("Record %s: %s", record.RecordID, err))
+			stats.Failed++
+			continue
+		}
+
+		recordProcessed()
+		if existing[record.RecordID] {
+			stats.Updated++
+		} else {
+			stats.Created++
+		}
+	}
+	return nil
+}
+
+// copyRecords copies all records of the record type from src to dst
+func copyRecords(src, dst skycontainer.SkyDB, recordType string) (stats copyStats, err error) {
+	tempDir, err := ioutil.TempDir("", "skycli")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	pageSize := queryPageSize
+	if pageSize <= 0 {
+		pageSize = skycontainer.DefaultPageSize
+	}
+
+	var batch []*skyrecord.Record
+	query := skycontainer.NewQuery(recordType).AddAscending("_created_at")
+	it := skycontainer.NewRecordIterator(src, query, pageSize)
+	for it.Next() {
+		batch = append(batch, it.Record())
+		if len(batch) < pageSize {
+			continue
+		}
+
+		err = copyRecordBatch(src, dst, recordType, batch, tempDir, &stats)
+		if err != nil {
+			return
+		}
+		batch = nil
+	}
+	if err = it.Err(); err != nil {
+		return
+	}
+
+	if len(batch) > 0 {
+		err = copyRecordBatch(src, dst, recordType, batch, tempDir, &stats)
+	}
+	return
+}
+
+// copyDatabase copies the schema and records of the record types from src
+// to dst, reporting the result to out. All record types are copied if
+// none is specified.
+func copyDatabase(src, dst skycontainer.SkyDB, recordTypes []string, out io.Writer) error {
+	schema, err := src.FetchSchema()
+	if err != nil {
+		return err
+	}
+
+	selected := map[string]bool{}
+	for _, recordType := range recordTypes {
+		if strings.Contains(recordType, "/") {
+			return fmt.Errorf("Record type cannot contain '/'.")
+		}
+		if _, ok := schema[recordType]; !ok {
+			return fmt.Errorf("Record type %s not found in schema.", recordType)
+		}
+		selected[recordType] = true
+	}
+
+	var copyTypes []string
+	for _, recordType := range recordTypeOrder(schema) {
+		if len(selected) == 0 || selected[recordType] {
+			copyTypes = append(copyTypes, recordType)
+		}
+	}
+
+	created, err := createMissingColumns(dst, schema, copyTypes)
+	for _, column := range created {
+		fmt.Fprintf(out, "Created column %s\n", column)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, recordType := range copyTypes {
+		stats, err := copyRecords(src, dst, recordType)
+		if err != nil {
+			return fmt.Errorf("Unable to copy %s: %s", recordType, err)
+		}
+		fmt.Fprintf(out, "%s: %d created, %d updated, %d skipped, %d failed\n",
+			recordType, stats.Created, stats.Updated, stats.Skipped, stats.Failed)
+	}
+	return nil
+}
+
+func newProfileDatabase(name string, write bool) *skycontainer.Database {
+	cfg, err := profileConfig(name)
+	if err != nil {
+		fatal(err)
+	}
+	if write {
+		warnMasterKeyUsage(cfg)
+	}
+
+	c := newContainerWithConfig(cfg)
+	return &skycontainer.Database{
+		Container:  c,
+		DatabaseID: usingDatabaseID(c),
+		Context:    databaseContext(),
+	}
+}
+
+var copyCmd = &cobra.Command{
+	Use:   "copy --from <profile> --to <profile> [<record_type> ...]",
+	Short: "Copy schema and records between two servers",
+	Long: `Records of the specified record types are copied from the server of one profile to the server of another.
+All record types are copied if none is specified. Missing columns are created and assets are uploaded again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if copyFromProfile == "" || copyToProfile == "" {
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if copyFromProfile == copyToProfile {
+			fatal(fmt.Errorf("Cannot copy to the same profile."))
+		}
+
+		src := newProfileDatabase(copyFromProfile, false)
+		dst := newProfileDatabase(copyToProfile, true)
+		err := copyDatabase(src, dst, args, os.Stdout)
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+func init() {
+	copyCmd.Flags().StringVar(&copyFromProfile, "from", "", "Profile of the server to copy from")
+	copyCmd.Flags().StringVar(&copyToProfile, "to", "", "Profile of the server to copy to")
+	copyCmd.Flags().BoolVar(&copySkipExisting, "skip-existing", false, "Do not update records that already exist")
+	copyCmd.Flags().BoolVarP(&recordUsePrivateDatabase, "private", "p", false, "Database. Default is Public.")
+	copyCmd.Flags().IntVar(&queryPageSize, "page-size", skycontainer.DefaultPageSize, "Number of records to query in each page")
+}
@@ -0,0 +1,92 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	fake "github.com/skygeario/skycli/container/fakecontainer"
+	skyrecord "github.com/skygeario/skycli/record"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCopyDatabase(t *testing.T) {
+	Convey("Copy database", t, func() {
+		src := fake.NewFakeDatabase()
+		So(src.CreateColumn("city", "name", "string"), ShouldBeNil)
+		So(src.CreateColumn("city", "image", "asset"), ShouldBeNil)
+		So(src.CreateColumn("country", "name", "string"), ShouldBeNil)
+		src.AssetList["asset-hongkong.jpg"] = []byte("hongkong")
+
+		for _, data := range []map[string]interface{}{
+			{
+				"_id":  "city/hongkong",
+				"name": "Hong Kong",
+				"image": map[string]interface{}{
+					"$type": "asset",
+					"$name": "asset-hongkong.jpg",
+					"$url":  "asset-hongkong.jpg",
+				},
+			},
+			{"_id": "city/paris", "name": "Paris"},
+			{"_id": "country/japan", "name": "Japan"},
+		} {
+			record, _ := skyrecord.MakeRecord(data)
+			So(src.SaveRecord(record), ShouldBeNil)
+		}
+
+		dst := fake.NewFakeDatabase()
+		So(dst.CreateColumn("city", "name", "string"), ShouldBeNil)
+		existing, _ := skyrecord.MakeRecord(map[string]interface{}{"_id": "city/paris", "name": "Old Paris"})
+		So(dst.SaveRecord(existing), ShouldBeNil)
+
+		defer func() {
+			copySkipExisting = false
+		}()
+
+		Convey("copies selected record types", func() {
+			var out bytes.Buffer
+			err := copyDatabase(src, dst, []string{"city"}, &out)
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldEqual,
+				"Created column city.image\ncity: 1 created, 1 updated, 0 skipped, 0 failed\n")
+
+			So(dst.RecordList["city"]["paris"].Data["name"], ShouldEqual, "Paris")
+			image, ok := dst.RecordList["city"]["hongkong"].Data["image"].(map[string]interface{})
+			So(ok, ShouldBeTrue)
+			So(image["$type"], ShouldEqual, "asset")
+			So(image["$name"], ShouldNotEqual, "asset-hongkong.jpg")
+			So(dst.RecordList["country"], ShouldBeNil)
+		})
+
+		Convey("skips existing records", func() {
+			copySkipExisting = true
+
+			var out bytes.Buffer
+			err := copyDatabase(src, dst, nil, &out)
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, "city: 1 created, 0 updated, 1 skipped, 0 failed\n")
+			So(out.String(), ShouldContainSubstring, "country: 1 created, 0 updated, 0 skipped, 0 failed\n")
+			So(dst.RecordList["city"]["paris"].Data["name"], ShouldEqual, "Old Paris")
+		})
+
+		Convey("rejects unknown record type", func() {
+			var out bytes.Buffer
+			err := copyDatabase(src, dst, []string{"student"}, &out)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,214 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// customComplexType is a complex type declared in the [complex_type.<name>]
+// section of the config file. The part of the value after the prefix is
+// matched by the pattern, and the named groups are passed to the template,
+// which outputs the converted value in JSON. The value is rendered by the
+// render template, which is passed the converted value.
+type customComplexType struct {
+	name     string
+	prefix   string
+	pattern  *regexp.Regexp
+	template *template.Template
+	render   *template.Template
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("%v is not a number", value)
+}
+
+// complexTemplateFuncs are the functions available to the templates of
+// custom complex types
+var complexTemplateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"number": toFloat,
+	"mul": func(a, b interface{}) (float64, error) {
+		x, err := toFloat(a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := toFloat(b)
+		return x * y, err
+	},
+	"div": func(a, b interface{}) (float64, error) {
+		x, err := toFloat(a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := toFloat(b)
+		if err == nil && y == 0 {
+			err = fmt.Errorf("division by zero")
+		}
+		return x / y, err
+	},
+	"round": func(value interface{}) (int64, error) {
+		x, err := toFloat(value)
+		return int64(math.Floor(x + 0.5)), err
+	},
+}
+
+// newCustomComplexType creates the complex type from the config values
+// prefix, pattern, template and render. Only prefix and template are
+// required.
+func newCustomComplexType(name string, values map[string]string) (*customComplexType, error) {
+	if values["prefix"] == "" {
+		return nil, fmt.Errorf("Complex type %s: prefix is required.", name)
+	}
+	if values["template"] == "" {
+		return nil, fmt.Errorf("Complex type %s: template is required.", name)
+	}
+
+	t := &customComplexType{
+		name:   name,
+		prefix: values["prefix"],
+	}
+
+	var err error
+	if values["pattern"] != "" {
+		t.pattern, err = regexp.Compile(values["pattern"])
+		if err != nil {
+			return nil, fmt.Errorf("Complex type %s: invalid pattern: %s", name, err)
+		}
+	}
+
+	t.template, err = template.New(name).Funcs(complexTemplateFuncs).Parse(values["template"])
+	if err != nil {
+		return nil, fmt.Errorf("Complex type %s: invalid template: %s", name, err)
+	}
+
+	if values["render"] != "" {
+		t.render, err = template.New(name + ".render").Funcs(complexTemplateFuncs).Parse(values["render"])
+		if err != nil {
+			return nil, fmt.Errorf("Complex type %s: invalid render template: %s", name, err)
+		}
+	}
+	return t, nil
+}
+
+func (t *customComplexType) Validate(valStr string) bool {
+	return strings.HasPrefix(valStr, t.prefix)
+}
+
+func (t *customComplexType) Convert(valStr string) (interface{}, error) {
+	str := strings.TrimPrefix(valStr, t.prefix)
+
+	// The whole value is available as .value in the template
+	data := map[string]string{"value": str}
+	if t.pattern != nil {
+		match := t.pattern.FindStringSubmatch(str)
+		if match == nil {
+			return "", fmt.Errorf("Wrong format of complex value(%s).", t.name)
+		}
+		for i, groupName := range t.pattern.SubexpNames() {
+			if groupName != "" {
+				data[groupName] = match[i]
+			}
+		}
+	}
+
+	var output bytes.Buffer
+	err := t.template.Execute(&output, data)
+	if err != nil {
+		return "", fmt.Errorf("Complex value(%s): %s", t.name, err)
+	}
+
+	var result interface{}
+	err = json.Unmarshal(output.Bytes(), &result)
+	if err != nil {
+		return "", fmt.Errorf("Complex value(%s): template output is not valid JSON: %s", t.name, err)
+	}
+	return result, nil
+}
+
+// Render renders the value if the render template is given. The value is
+// of the complex type only if the rendered form converts to the same value.
+func (t *customComplexType) Render(value interface{}) (string, bool) {
+	if t.render == nil {
+		return "", false
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		return "", false
+	}
+
+	var output bytes.Buffer
+	if t.render.Execute(&output, value) != nil {
+		return "", false
+	}
+	rendered := t.prefix + output.String()
+
+	converted, err := t.Convert(rendered)
+	if err != nil || jsonString(converted) != jsonString(value) {
+		return "", false
+	}
+	return rendered, true
+}
+
+// loadConfigComplexTypes registers the complex types declared in the
+// config file, replacing those registered from the config file before
+func loadConfigComplexTypes() error {
+	var complexTypes []ComplexType
+	for _, complexType := range ComplexTypeList {
+		if _, ok := complexType.(*customComplexType); !ok {
+			complexTypes = append(complexTypes, complexType)
+		}
+	}
+	ComplexTypeList = complexTypes
+
+	declared := viper.GetStringMap("complex_type")
+	var names []string
+	for name := range declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		complexType, err := newCustomComplexType(name, cast.ToStringMapString(declared[name]))
+		if err != nil {
+			return err
+		}
+		RegisterComplexType(complexType)
+	}
+	return nil
+}
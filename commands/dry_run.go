@@ -0,0 +1,202 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	skyrecord "github.com/skygeario/skycli/record"
+)
+
+var dryRun bool
+
+// dryRunPrinter prints the requests which are not sent in dry-run mode
+type dryRunPrinter struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+func (p *dryRunPrinter) DryRunRequest(trace *skycontainer.RequestTrace) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "Dry run: %s %s", trace.Method, trace.URL)
+	if trace.Action != "" {
+		fmt.Fprintf(&out, " (%s)", trace.Action)
+	}
+	fmt.Fprintln(&out)
+
+	if len(trace.RequestBody) > 0 {
+		if json.Indent(&out, trace.RequestBody, "", "  ") != nil {
+			out.Write(trace.RequestBody)
+		}
+		fmt.Fprintln(&out)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.w.Write(out.Bytes())
+}
+
+// newDryRunner returns the printer of requests not sent, or nil if not
+// in dry-run mode
+func newDryRunner() skycontainer.DryRunner {
+	if !dryRun {
+		return nil
+	}
+	return &dryRunPrinter{w: os.Stdout}
+}
+
+// dryRunDatabase prints the changes to the records on the server before
+// they are passed to the database, whose container does not send them in
+// dry-run mode
+type dryRunDatabase struct {
+	skycontainer.SkyDB
+	w io.Writer
+}
+
+func jsonString(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+// recordDiff returns the changes to the current record by saving the
+// record, which is a new record if current is nil
+func recordDiff(current, record *skyrecord.Record) string {
+	var diff bytes.Buffer
+	if current == nil {
+		fmt.Fprintf(&diff, "+ %s (new record)\n", record.RecordID)
+	} else {
+		fmt.Fprintf(&diff, "~ %s\n", record.RecordID)
+	}
+
+	var keys []string
+	for key := range record.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changed := false
+	for _, key := range keys {
+		newValue := jsonString(record.Data[key])
+		if current != nil {
+			oldValue, ok := current.Data[key]
+			if ok && jsonString(oldValue) == newValue {
+				continue
+			}
+			if ok {
+				fmt.Fprintf(&diff, "-   %s: %s\n", key, jsonString(oldValue))
+			}
+		}
+		fmt.Fprintf(&diff, "+   %s: %s\n", key, newValue)
+		changed = true
+	}
+
+	if current != nil && !changed {
+		fmt.Fprintf(&diff, "    (no changes)\n")
+	}
+	return diff.String()
+}
+
+// printDiff prints the changes by saving the records, and returns the
+// errors of fetching the current records in the order of recordList.
+// Records not found are new records.
+func (d *dryRunDatabase) printDiff(recordList []*skyrecord.Record) []error {
+	errs := make([]error, len(recordList))
+	for i, record := range recordList {
+		current, err := d.SkyDB.FetchRecord(record.RecordID)
+		if err != nil && !isNotFound(err) {
+			errs[i] = fmt.Errorf("Record %s: Unable to fetch the current record: %s", record.RecordID, err)
+			fmt.Fprintf(d.w, "! %s (unable to fetch the current record)\n", record.RecordID)
+			continue
+		}
+		fmt.Fprint(d.w, recordDiff(current, record))
+	}
+	return errs
+}
+
+func (d *dryRunDatabase) SaveRecord(record *skyrecord.Record) error {
+	if err := d.printDiff([]*skyrecord.Record{record})[0]; err != nil {
+		return err
+	}
+	return d.SkyDB.SaveRecord(record)
+}
+
+// SaveRecords simulates saving the records whose current records can be
+// fetched, and returns the errors of fetching for the others
+func (d *dryRunDatabase) SaveRecords(recordList []*skyrecord.Record) ([]error, error) {
+	errs := d.printDiff(recordList)
+
+	var saving []*skyrecord.Record
+	for i, record := range recordList {
+		if errs[i] == nil {
+			saving = append(saving, record)
+		}
+	}
+	if len(saving) == 0 {
+		return errs, nil
+	}
+
+	saveErrs, err := d.SkyDB.SaveRecords(saving)
+	if err != nil {
+		return nil, err
+	}
+	for i := range errs {
+		if errs[i] == nil {
+			errs[i], saveErrs = saveErrs[0], saveErrs[1:]
+		}
+	}
+	return errs, nil
+}
+
+// DeleteRecord prints the records to be deleted, and returns the first
+// error of fetching the records like deleting them
+func (d *dryRunDatabase) DeleteRecord(recordIDList []string) error {
+	var fetchErr error
+	for _, recordID := range recordIDList {
+		_, err := d.SkyDB.FetchRecord(recordID)
+		switch {
+		case isNotFound(err):
+			fmt.Fprintf(d.w, "  %s (not found)\n", recordID)
+		case err != nil:
+			err = fmt.Errorf("Record %s: Unable to fetch the record: %s", recordID, err)
+			fmt.Fprintf(d.w, "! %s (unable to fetch the record)\n", recordID)
+		default:
+			fmt.Fprintf(d.w, "- %s (deleted)\n", recordID)
+		}
+
+		if err != nil {
+			if fetchErr == nil {
+				fetchErr = err
+			} else {
+				warn(err)
+			}
+		}
+	}
+
+	err := d.SkyDB.DeleteRecord(recordIDList)
+	if err != nil {
+		return err
+	}
+	return fetchErr
+}
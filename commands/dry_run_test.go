@@ -0,0 +1,178 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	skyrecord "github.com/skygeario/skycli/record"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDryRun(t *testing.T) {
+	Convey("Dry run", t, func() {
+		var actions []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&payload)
+			action, _ := payload["action"].(string)
+			actions = append(actions, action)
+
+			ids, _ := payload["ids"].([]interface{})
+			if len(ids) > 0 && ids[0] == "note/missing" {
+				w.Write([]byte(`{"result":[{"_id":"note/missing","_type":"error","name":"ResourceNotFound","code":110,"message":"record not found"}]}`))
+				return
+			}
+			if len(ids) > 0 && ids[0] == "note/denied" {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error":{"name":"PermissionDenied","code":102,"message":"no permission"}}`))
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": []interface{}{
+					map[string]interface{}{
+						"_id":   "note/1",
+						"_type": "record",
+						"title": "old",
+						"count": 1,
+					},
+				},
+			})
+		}))
+		defer server.Close()
+
+		var out bytes.Buffer
+		c := &skycontainer.Container{
+			Endpoint:    server.URL + "/",
+			AccessToken: "secret-token",
+			DryRun:      &dryRunPrinter{w: &out},
+		}
+		db := &dryRunDatabase{
+			&skycontainer.Database{Container: c, DatabaseID: "_public"},
+			&out,
+		}
+
+		Convey("prints saved records without saving", func() {
+			record, _ := skyrecord.MakeEmptyRecord("note/1")
+			record.Set("title", "new")
+			record.Set("count", 1)
+
+			err := db.SaveRecord(record)
+			So(err, ShouldBeNil)
+			So(actions, ShouldResemble, []string{"record:fetch"})
+			So(out.String(), ShouldContainSubstring, `~ note/1
+-   title: "old"
++   title: "new"
+`)
+			So(out.String(), ShouldNotContainSubstring, "+   count")
+			So(out.String(), ShouldContainSubstring, "Dry run: POST "+server.URL+"/record/save (record:save)")
+			So(out.String(), ShouldContainSubstring, `"database_id": "_public"`)
+			So(out.String(), ShouldNotContainSubstring, "secret-token")
+		})
+
+		Convey("simulates saving records", func() {
+			note1, _ := skyrecord.MakeEmptyRecord("note/1")
+			note2, _ := skyrecord.MakeEmptyRecord("note/2")
+			errs, err := db.SaveRecords([]*skyrecord.Record{note1, note2})
+			So(err, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil})
+			So(actions, ShouldResemble, []string{"record:fetch", "record:fetch"})
+		})
+
+		Convey("prints records not found as new records", func() {
+			record, _ := skyrecord.MakeEmptyRecord("note/missing")
+			record.Set("title", "new")
+
+			err := db.SaveRecord(record)
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, "+ note/missing (new record)\n")
+		})
+
+		Convey("reports records unable to be fetched", func() {
+			denied, _ := skyrecord.MakeEmptyRecord("note/denied")
+			note, _ := skyrecord.MakeEmptyRecord("note/1")
+
+			errs, err := db.SaveRecords([]*skyrecord.Record{denied, note})
+			So(err, ShouldBeNil)
+			So(errs[0], ShouldNotBeNil)
+			So(errs[1], ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, "! note/denied (unable to fetch the current record)\n")
+			So(out.String(), ShouldNotContainSubstring, "note/denied (new record)")
+
+			err = db.SaveRecord(denied)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("prints records not found when deleting", func() {
+			err := db.DeleteRecord([]string{"note/missing"})
+			So(exitCode(err), ShouldEqual, exitNotFound)
+			So(out.String(), ShouldContainSubstring, "  note/missing (not found)\n")
+		})
+
+		Convey("prints deleted records without deleting", func() {
+			err := db.DeleteRecord([]string{"note/1"})
+			So(err, ShouldBeNil)
+			So(actions, ShouldResemble, []string{"record:fetch"})
+			So(out.String(), ShouldContainSubstring, "- note/1 (deleted)\n")
+			So(out.String(), ShouldContainSubstring, "(record:delete)")
+		})
+
+		Convey("does not change schema", func() {
+			err := db.CreateColumn("note", "title", "string")
+			So(err, ShouldBeNil)
+			So(actions, ShouldBeEmpty)
+			So(out.String(), ShouldContainSubstring, "(schema:create)")
+		})
+
+		Convey("does not upload assets", func() {
+			f, err := ioutil.TempFile("", "skycli")
+			So(err, ShouldBeNil)
+			f.Close()
+			defer os.Remove(f.Name())
+
+			name, err := db.SaveAsset(f.Name())
+			So(err, ShouldBeNil)
+			So(name, ShouldNotBeEmpty)
+			So(actions, ShouldBeEmpty)
+			So(out.String(), ShouldStartWith, "Dry run: PUT "+server.URL+"/files/")
+		})
+	})
+}
+
+func TestRecordDiff(t *testing.T) {
+	Convey("Record diff", t, func() {
+		record, _ := skyrecord.MakeEmptyRecord("note/1")
+		record.Set("title", "hello")
+
+		Convey("of new record", func() {
+			So(recordDiff(nil, record), ShouldEqual, "+ note/1 (new record)\n+   title: \"hello\"\n")
+		})
+
+		Convey("of unchanged record", func() {
+			current, _ := skyrecord.MakeEmptyRecord("note/1")
+			current.Set("title", "hello")
+			current.Set("body", "world")
+			So(recordDiff(current, record), ShouldEqual, "~ note/1\n    (no changes)\n")
+		})
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	skycontainer "github.com/skygeario/skycli/container"
+)
+
+// Exit statuses of skycli
+const (
+	exitGeneralError    = 1
+	exitNotFound        = 3
+	exitPermission      = 4
+	exitConflict        = 5
+	exitInvalidArgument = 6
+	exitInterrupted     = 130
+)
+
+var errorFormat string
+
+// exitCode returns the exit status for the error
+func exitCode(err error) int {
+	skygearError, ok := err.(*skycontainer.SkygearError)
+	if !ok {
+		return exitGeneralError
+	}
+
+	switch skygearError.Code {
+	case skycontainer.ResourceNotFound:
+		return exitNotFound
+	case skycontainer.NotAuthenticated, skycontainer.PermissionDenied,
+		skycontainer.AccessKeyNotAccepted, skycontainer.AccessTokenNotAccepted,
+		skycontainer.InvalidCredentials:
+		return exitPermission
+	case skycontainer.Duplicated, skycontainer.ConstraintViolated:
+		return exitConflict
+	case skycontainer.BadRequest, skycontainer.InvalidArgument:
+		return exitInvalidArgument
+	}
+	return exitGeneralError
+}
+
+// isNotFound returns whether the error is a Skygear error of resource not
+// found
+func isNotFound(err error) bool {
+	skygearError, ok := err.(*skycontainer.SkygearError)
+	return ok && skygearError.Code == skycontainer.ResourceNotFound
+}
+
+// errorData returns the error as a map for printing in JSON
+func errorData(err error) map[string]interface{} {
+	data := map[string]interface{}{
+		"message": err.Error(),
+	}
+
+	if skygearError, ok := err.(*skycontainer.SkygearError); ok {
+		data["code"] = skygearError.Code
+		if skygearError.Name != "" {
+			data["name"] = skygearError.Name
+		}
+		if skygearError.ID != "" {
+			data["id"] = skygearError.ID
+		}
+		if skygearError.Info != nil {
+			data["info"] = skygearError.Info
+		}
+	}
+	return data
+}
+
+// formatError returns the error message to be printed with the prefix.
+// It is a single line of JSON if the error format is json.
+func formatError(prefix string, err error) string {
+	if errorFormat != "json" {
+		if skygearError, ok := err.(*skycontainer.SkygearError); ok && skygearError.ID != "" {
+			return fmt.Sprintf("%s: Record %s: %s", prefix, skygearError.ID, err)
+		}
+		return fmt.Sprintf("%s: %s", prefix, err)
+	}
+
+	data, jsonErr := json.Marshal(map[string]interface{}{
+		"level": strings.ToLower(prefix),
+		"error": errorData(err),
+	})
+	if jsonErr != nil {
+		return fmt.Sprintf("%s: %s", prefix, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,128 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	fake "github.com/skygeario/skycli/container/fakecontainer"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSkygearError(t *testing.T) {
+	Convey("Skygear error", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":{"name":"PermissionDenied","code":102,"message":"no permission","info":{"record_type":"note"}}}`))
+		}))
+		defer server.Close()
+
+		c := &skycontainer.Container{Endpoint: server.URL + "/"}
+		db := &skycontainer.Database{Container: c, DatabaseID: "_public"}
+		_, err := db.FetchSchema()
+
+		skygearError, ok := err.(*skycontainer.SkygearError)
+		So(ok, ShouldBeTrue)
+		So(skygearError, ShouldResemble, &skycontainer.SkygearError{
+			Name:    "PermissionDenied",
+			Code:    skycontainer.PermissionDenied,
+			Message: "no permission",
+			Info:    map[string]interface{}{"record_type": "note"},
+		})
+		So(exitCode(err), ShouldEqual, exitPermission)
+	})
+}
+
+func TestRecordError(t *testing.T) {
+	Convey("Record error", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"result":[{"_id":"note/1","_type":"record"},{"_id":"note/2","_type":"error","name":"ResourceNotFound","code":110,"message":"record not found"}]}`))
+		}))
+		defer server.Close()
+
+		c := &skycontainer.Container{Endpoint: server.URL + "/"}
+		db := &skycontainer.Database{Container: c, DatabaseID: "_public"}
+
+		Convey("is returned when deleting records", func() {
+			err := db.DeleteRecord([]string{"note/1", "note/2"})
+			So(err, ShouldNotBeNil)
+			So(err.(*skycontainer.SkygearError).ID, ShouldEqual, "note/2")
+			So(exitCode(err), ShouldEqual, exitNotFound)
+		})
+
+		Convey("is returned when querying records", func() {
+			_, err := db.QueryRecord(skycontainer.NewQuery("note"))
+			So(err, ShouldNotBeNil)
+			So(exitCode(err), ShouldEqual, exitNotFound)
+		})
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	Convey("Exit code", t, func() {
+		db := fake.NewFakeDatabase()
+		_, err := db.FetchRecord("note/notexist")
+		So(exitCode(err), ShouldEqual, exitNotFound)
+
+		So(exitCode(&skycontainer.SkygearError{Code: skycontainer.Duplicated}), ShouldEqual, exitConflict)
+		So(exitCode(&skycontainer.SkygearError{Code: skycontainer.InvalidArgument}), ShouldEqual, exitInvalidArgument)
+		So(exitCode(&skycontainer.SkygearError{Code: skycontainer.UnexpectedError}), ShouldEqual, exitGeneralError)
+		So(exitCode(fmt.Errorf("Unexpected server data.")), ShouldEqual, exitGeneralError)
+	})
+}
+
+func TestFormatError(t *testing.T) {
+	Convey("Format error", t, func() {
+		defer func() {
+			errorFormat = "text"
+		}()
+
+		err := &skycontainer.SkygearError{
+			ID:      "note/1",
+			Name:    "ResourceNotFound",
+			Code:    skycontainer.ResourceNotFound,
+			Message: "record not found",
+		}
+
+		Convey("in text", func() {
+			errorFormat = "text"
+			So(formatError("Error", err), ShouldEqual, "Error: Record note/1: record not found")
+			So(formatError("Error", fmt.Errorf("failed")), ShouldEqual, "Error: failed")
+		})
+
+		Convey("in JSON", func() {
+			errorFormat = "json"
+			var data map[string]interface{}
+			So(json.Unmarshal([]byte(formatError("Warning", err)), &data), ShouldBeNil)
+			So(data, ShouldResemble, map[string]interface{}{
+				"level": "warning",
+				"error": map[string]interface{}{
+					"id":      "note/1",
+					"name":    "ResourceNotFound",
+					"code":    float64(110),
+					"message": "record not found",
+				},
+			})
+
+			So(json.Unmarshal([]byte(formatError("Error", fmt.Errorf("failed"))), &data), ShouldBeNil)
+			So(data["error"], ShouldResemble, map[string]interface{}{"message": "failed"})
+		})
+	})
+}
@@ -0,0 +1,212 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	skycontainer "github.com/skygeario/skycli/container"
+)
+
+// stdinSource is the source of records read from stdin in the journal
+const stdinSource = "-"
+
+// defaultImportJournalPath is the journal used by --resume if --journal is
+// not given
+const defaultImportJournalPath = ".skycli-import.journal"
+
+var importJournalPath string
+var importResume bool
+
+// journalEntry is a line in the import journal. It records either a
+// record saved by the server, or an uploaded asset.
+type journalEntry struct {
+	Source string `json:"source,omitempty"`
+	Index  int    `json:"index,omitempty"`
+	Asset  string `json:"asset,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// importJournal records the progress of an import, so that records and
+// assets already saved are skipped when the import is resumed. Entries
+// are appended as they are acknowledged by the server, so the journal is
+// up to date even if skycli exits early.
+type importJournal struct {
+	path string
+
+	mutex   sync.Mutex
+	f       *os.File
+	assets  map[string]string
+	records map[string]map[int]bool
+}
+
+// importJournalFilePath returns the path of the journal recording the
+// import of paths, or an empty string if no journal is requested by
+// --journal or --resume. Records read from stdin cannot be located again,
+// so the import from stdin cannot be resumed.
+func importJournalFilePath(paths []string) (string, error) {
+	if importJournalPath == "" && !importResume {
+		return "", nil
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("Unable to resume an import from stdin. Specify the files to import to use --journal or --resume.")
+	}
+	if importJournalPath == "" {
+		return defaultImportJournalPath, nil
+	}
+	return importJournalPath, nil
+}
+
+// openImportJournal opens the journal at path. The progress recorded in
+// the existing journal is loaded if resume is true, otherwise the journal
+// is started afresh.
+func openImportJournal(path string, resume bool) (*importJournal, error) {
+	j := &importJournal{
+		path:    path,
+		assets:  map[string]string{},
+		records: map[string]map[int]bool{},
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		err := j.load()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flag, 0600)
+	if err != nil {
+		return nil, err
+	}
+	j.f = f
+	return j, nil
+}
+
+func (j *importJournal) load() error {
+	f, err := os.Open(j.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry journalEntry
+		// The last line is incomplete if skycli exited while writing it
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+
+		if entry.Asset != "" {
+			j.assets[entry.Asset] = entry.Name
+		} else if entry.Source != "" {
+			j.markRecord(entry.Source, entry.Index)
+		}
+	}
+	return scanner.Err()
+}
+
+func (j *importJournal) markRecord(source string, index int) {
+	if j.records[source] == nil {
+		j.records[source] = map[int]bool{}
+	}
+	j.records[source][index] = true
+}
+
+func (j *importJournal) append(entry journalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = j.f.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("Unable to write import journal: %s", err)
+	}
+	return nil
+}
+
+// recordImported returns whether the record at index of the source is
+// saved according to the journal
+func (j *importJournal) recordImported(source string, index int) bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.records[source][index]
+}
+
+// addRecord records that the record at index of the source is saved
+func (j *importJournal) addRecord(source string, index int) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.markRecord(source, index)
+	return j.append(journalEntry{Source: source, Index: index})
+}
+
+// assetName returns the name of the uploaded asset of the file at path
+func (j *importJournal) assetName(path string) (string, bool) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	name, ok := j.assets[path]
+	return name, ok
+}
+
+// addAsset records that the file at path is uploaded as the asset name
+func (j *importJournal) addAsset(path, name string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.assets[path] = name
+	return j.append(journalEntry{Asset: path, Name: name})
+}
+
+// close closes the journal, removing it if remove is true
+func (j *importJournal) close(remove bool) error {
+	err := j.f.Close()
+	if remove {
+		return os.Remove(j.path)
+	}
+	return err
+}
+
+// journalDatabase uploads assets through the journal, so that an asset
+// uploaded before is not uploaded again
+type journalDatabase struct {
+	skycontainer.SkyDB
+	journal *importJournal
+}
+
+func (d *journalDatabase) SaveAsset(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if name, ok := d.journal.assetName(absPath); ok {
+		return name, nil
+	}
+
+	name, err := d.SkyDB.SaveAsset(path)
+	if err != nil {
+		return "", err
+	}
+	if err := d.journal.addAsset(absPath, name); err != nil {
+		warn(err)
+	}
+	return name, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+)
+
+// commandContext is cancelled when the command is interrupted
+var commandContext = context.Background()
+
+var interruptOnce sync.Once
+var interruptFlag int32
+
+// processedRecords is the number of records processed by the command,
+// which is reported when the command is interrupted
+var processedRecords int64
+
+// databaseContext returns the context for database requests. Requests
+// made with it are cancelled on the first SIGINT, and skycli exits
+// immediately on the second one.
+func databaseContext() context.Context {
+	interruptOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		commandContext = ctx
+
+		signals := make(chan os.Signal, 2)
+		signal.Notify(signals, os.Interrupt)
+		go func() {
+			<-signals
+			atomic.StoreInt32(&interruptFlag, 1)
+			fmt.Fprintln(os.Stderr, "Interrupted. Press Ctrl-C again to exit immediately.")
+			cancel()
+
+			<-signals
+			os.Exit(exitInterrupted)
+		}()
+	})
+	return commandContext
+}
+
+func interrupted() bool {
+	return atomic.LoadInt32(&interruptFlag) == 1
+}
+
+func recordProcessed() {
+	atomic.AddInt64(&processedRecords, 1)
+}
+
+// exitIfInterrupted prints how far the command got and exits if the
+// command is interrupted. Errors after interruption are caused by the
+// cancelled requests, so they are not reported.
+func exitIfInterrupted() {
+	if !interrupted() {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Stopped after processing %d records.\n", atomic.LoadInt64(&processedRecords))
+	os.Exit(exitInterrupted)
+}
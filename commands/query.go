@@ -0,0 +1,224 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	skycontainer "github.com/skygeario/skycli/container"
+)
+
+// stringListFlag is a flag that can be specified multiple times. Unlike
+// a string slice flag, the value is not split by comma.
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func (f *stringListFlag) Type() string {
+	return "stringList"
+}
+
+var (
+	whereNearRegexp = regexp.MustCompile(
+		`(?i)^\s*([\w.$]+)\s+near\s+(-?[\d.]+)\s*,\s*(-?[\d.]+)\s+within\s+([\d.]+)\s*(m|km)?\s*$`)
+	whereWordRegexp = regexp.MustCompile(
+		`(?i)^\s*([\w.$]+)\s+(like|ilike|in)\s+(.*?)\s*$`)
+	whereSymbolRegexp = regexp.MustCompile(
+		`^\s*([\w.$]+)\s*(==|!=|>=|<=|=|>|<)\s*(.*?)\s*$`)
+)
+
+// parseWhere parses a where expression and adds the resulting condition
+// to the query. Supported expressions are:
+//
+//	key=value, key!=value, key>value, key>=value, key<value, key<=value
+//	key like "pattern", key ilike "pattern"
+//	key in (value, ...)
+//	key near lat,lng within distance[m|km]
+func parseWhere(query *skycontainer.Query, expr string) error {
+	if match := whereNearRegexp.FindStringSubmatch(expr); match != nil {
+		var coords [3]float64
+		for i, s := range match[2:5] {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return fmt.Errorf("Where expression '%s': %s", expr, err)
+			}
+			coords[i] = f
+		}
+		distance := coords[2]
+		if strings.ToLower(match[5]) == "km" {
+			distance *= 1000
+		}
+		query.DistanceLessThan(match[1], coords[0], coords[1], distance)
+		return nil
+	}
+
+	if match := whereWordRegexp.FindStringSubmatch(expr); match != nil {
+		key := match[1]
+		switch strings.ToLower(match[2]) {
+		case "like", "ilike":
+			pattern, ok := parseWhereValue(match[3]).(string)
+			if !ok {
+				return fmt.Errorf("Where expression '%s': pattern is not a string.", expr)
+			}
+			if strings.ToLower(match[2]) == "like" {
+				query.Like(key, pattern)
+			} else {
+				query.CaseInsensitiveLike(key, pattern)
+			}
+		case "in":
+			values, err := parseWhereList(match[3])
+			if err != nil {
+				return fmt.Errorf("Where expression '%s': %s", expr, err)
+			}
+			query.In(key, values)
+		}
+		return nil
+	}
+
+	if match := whereSymbolRegexp.FindStringSubmatch(expr); match != nil {
+		key := match[1]
+		value := parseWhereValue(match[3])
+		switch match[2] {
+		case "=", "==":
+			query.Equal(key, value)
+		case "!=":
+			query.NotEqual(key, value)
+		case ">":
+			query.GreaterThan(key, value)
+		case ">=":
+			query.GreaterThanOrEqual(key, value)
+		case "<":
+			query.LessThan(key, value)
+		case "<=":
+			query.LessThanOrEqual(key, value)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("Where expression '%s' not in correct format. Expected: <key><operator><value>", expr)
+}
+
+// parseWhereValue converts the literal in a where expression to a value.
+// Quoted literals are always strings; complex value shorthands
+// (e.g. @ref:) are converted to the corresponding structure.
+func parseWhereValue(str string) interface{} {
+	if len(str) >= 2 {
+		if str[0] == '"' && str[len(str)-1] == '"' {
+			if unquoted, err := strconv.Unquote(str); err == nil {
+				return unquoted
+			}
+		}
+		if str[0] == '\'' && str[len(str)-1] == '\'' {
+			return str[1 : len(str)-1]
+		}
+	}
+
+	switch str {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+
+	if f, err := strconv.ParseFloat(str, 64); err == nil {
+		return f
+	}
+
+	for _, complexType := range ComplexTypeList {
+		if complexType.Validate(str) {
+			if result, err := complexType.Convert(str); err == nil {
+				return result
+			}
+		}
+	}
+
+	return str
+}
+
+// parseWhereList converts a list literal, either a JSON array or
+// a parenthesized comma-separated list, to a list of values
+func parseWhereList(str string) ([]interface{}, error) {
+	if strings.HasPrefix(str, "[") {
+		var values []interface{}
+		err := json.Unmarshal([]byte(str), &values)
+		return values, err
+	}
+
+	if strings.HasPrefix(str, "(") && strings.HasSuffix(str, ")") {
+		str = str[1 : len(str)-1]
+	}
+
+	values := []interface{}{}
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		values = append(values, parseWhereValue(item))
+	}
+	return values, nil
+}
+
+// parseSort adds sort orders to the query from a comma-separated list of
+// keys. A key prefixed with `-` is sorted in descending order.
+func parseSort(query *skycontainer.Query, sortExpr string) error {
+	for _, key := range strings.Split(sortExpr, ",") {
+		key = strings.TrimSpace(key)
+		if strings.HasPrefix(key, "-") {
+			key = strings.TrimPrefix(key, "-")
+			if key != "" {
+				query.AddDescending(key)
+				continue
+			}
+		} else {
+			key = strings.TrimPrefix(key, "+")
+			if key != "" {
+				query.AddAscending(key)
+				continue
+			}
+		}
+		return fmt.Errorf("Sort '%s' not in correct format. Expected: [-]key[,[-]key ...]", sortExpr)
+	}
+	return nil
+}
+
+// makeQuery creates a query of the record type with the where expressions
+func makeQuery(recordType string, whereExprs []string) (*skycontainer.Query, error) {
+	if strings.Contains(recordType, "/") {
+		return nil, fmt.Errorf("Record type cannot contain '/'.")
+	}
+
+	query := skycontainer.NewQuery(recordType)
+	for _, expr := range whereExprs {
+		err := parseWhere(query, expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return query, nil
+}
@@ -0,0 +1,278 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"testing"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	fake "github.com/skygeario/skycli/container/fakecontainer"
+	skyrecord "github.com/skygeario/skycli/record"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseWhere(t *testing.T) {
+	Convey("Parse Where", t, func() {
+		query := skycontainer.NewQuery("test")
+
+		Convey("gets a comparison with number", func() {
+			err := parseWhere(query, "age>10")
+			So(err, ShouldBeNil)
+			So(query.Predicate(), ShouldResemble, skycontainer.Predicate{
+				"gt", skycontainer.KeyPath("age"), 10.0,
+			})
+		})
+
+		Convey("gets an equality with quoted string", func() {
+			err := parseWhere(query, `name = "10"`)
+			So(err, ShouldBeNil)
+			So(query.Predicate(), ShouldResemble, skycontainer.Predicate{
+				"eq", skycontainer.KeyPath("name"), "10",
+			})
+		})
+
+		Convey("gets a like expression", func() {
+			err := parseWhere(query, `name like "Al%"`)
+			So(err, ShouldBeNil)
+			So(query.Predicate(), ShouldResemble, skycontainer.Predicate{
+				"like", skycontainer.KeyPath("name"), "Al%",
+			})
+		})
+
+		Convey("gets an in expression", func() {
+			err := parseWhere(query, `age in (1, 2, "3")`)
+			So(err, ShouldBeNil)
+			So(query.Predicate(), ShouldResemble, skycontainer.Predicate{
+				"in", skycontainer.KeyPath("age"), []interface{}{1.0, 2.0, "3"},
+			})
+		})
+
+		Convey("gets a reference", func() {
+			err := parseWhere(query, "owner=@ref:user/1")
+			So(err, ShouldBeNil)
+			So(query.Predicate(), ShouldResemble, skycontainer.Predicate{
+				"eq",
+				skycontainer.KeyPath("owner"),
+				map[string]interface{}{"$type": "ref", "$id": "user/1"},
+			})
+		})
+
+		Convey("gets a distance expression", func() {
+			err := parseWhere(query, "loc near 22.3,114.1 within 5km")
+			So(err, ShouldBeNil)
+			So(query.Predicate(), ShouldResemble, skycontainer.Predicate{
+				"lt",
+				[]interface{}{
+					"func",
+					"distance",
+					skycontainer.KeyPath("loc"),
+					map[string]interface{}{"$type": "geo", "$lat": 22.3, "$lng": 114.1},
+				},
+				5000.0,
+			})
+		})
+
+		Convey("combines multiple expressions", func() {
+			So(parseWhere(query, "age>10"), ShouldBeNil)
+			So(parseWhere(query, "age<20"), ShouldBeNil)
+			predicate := query.Predicate()
+			So(len(predicate), ShouldEqual, 3)
+			So(predicate[0], ShouldEqual, "and")
+		})
+
+		Convey("gets a malformed expression", func() {
+			err := parseWhere(query, "age")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestQueryRecordWithPredicate(t *testing.T) {
+	Convey("Query with predicate", t, func() {
+		db := fake.NewFakeDatabase()
+		for _, data := range []map[string]interface{}{
+			{"_id": "student/1", "name": "Alice", "age": 10.0},
+			{"_id": "student/2", "name": "Bob", "age": 12.0},
+			{"_id": "student/3", "name": "Alan", "age": 14.0},
+		} {
+			record, _ := skyrecord.MakeRecord(data)
+			So(saveRecord(db, record, ""), ShouldBeNil)
+		}
+
+		query, err := makeQuery("student", []string{`name like "Al%"`, "age>10"})
+		So(err, ShouldBeNil)
+
+		output, err := queryRecord(db, query)
+		So(err, ShouldBeNil)
+		So(len(output), ShouldEqual, 1)
+		So(output[0].RecordID, ShouldEqual, "student/3")
+	})
+
+	Convey("Query with wrong record type", t, func() {
+		_, err := makeQuery("student/1", nil)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestParseSort(t *testing.T) {
+	Convey("Parse Sort", t, func() {
+		query := skycontainer.NewQuery("test")
+
+		Convey("gets ascending and descending keys", func() {
+			err := parseSort(query, "name,-age")
+			So(err, ShouldBeNil)
+			So(query.Sorts, ShouldResemble, []skycontainer.Sort{
+				{Key: "name", Order: skycontainer.Ascending},
+				{Key: "age", Order: skycontainer.Descending},
+			})
+			So(query.MakePayload()["sort"], ShouldResemble, []interface{}{
+				[]interface{}{skycontainer.KeyPath("name"), "asc"},
+				[]interface{}{skycontainer.KeyPath("age"), "desc"},
+			})
+		})
+
+		Convey("gets an empty key", func() {
+			err := parseSort(query, "name,-")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRecordIterator(t *testing.T) {
+	Convey("Record Iterator", t, func() {
+		db := fake.NewFakeDatabase()
+		for _, data := range []map[string]interface{}{
+			{"_id": "student/1", "age": 10.0},
+			{"_id": "student/2", "age": 14.0},
+			{"_id": "student/3", "age": 12.0},
+			{"_id": "student/4", "age": 11.0},
+			{"_id": "student/5", "age": 13.0},
+		} {
+			record, _ := skyrecord.MakeRecord(data)
+			So(saveRecord(db, record, ""), ShouldBeNil)
+		}
+
+		iterate := func(query *skycontainer.Query) []string {
+			var ids []string
+			it := skycontainer.NewRecordIterator(db, query, 2)
+			for it.Next() {
+				ids = append(ids, it.Record().RecordID)
+			}
+			So(it.Err(), ShouldBeNil)
+			return ids
+		}
+
+		Convey("iterates through all pages", func() {
+			query := skycontainer.NewQuery("student").AddDescending("age")
+			So(iterate(query), ShouldResemble, []string{
+				"student/2", "student/5", "student/3", "student/4", "student/1",
+			})
+		})
+
+		Convey("respects limit and offset", func() {
+			query := skycontainer.NewQuery("student").AddAscending("age")
+			query.Offset = 1
+			query.Limit = 3
+			So(iterate(query), ShouldResemble, []string{
+				"student/4", "student/3", "student/5",
+			})
+		})
+
+		Convey("iterates through empty result", func() {
+			query := skycontainer.NewQuery("notexist")
+			So(iterate(query), ShouldBeNil)
+		})
+
+		Convey("sorts by record ID after the sorts of the query", func() {
+			recording := &sortRecordingDatabase{FakeDatabase: db}
+			query := skycontainer.NewQuery("student").AddDescending("age")
+
+			it := skycontainer.NewRecordIterator(recording, query, 10)
+			for it.Next() {
+			}
+			So(recording.sorts, ShouldResemble, [][]skycontainer.Sort{{
+				{Key: "age", Order: skycontainer.Descending},
+				{Key: "_id", Order: skycontainer.Ascending},
+			}})
+			So(query.Sorts, ShouldHaveLength, 1)
+		})
+
+		Convey("continues after results dropped by the database", func() {
+			dropping := &droppingDatabase{db, "student/4"}
+			query := skycontainer.NewQuery("student").AddAscending("age")
+
+			var ids []string
+			it := skycontainer.NewRecordIterator(dropping, query, 2)
+			for it.Next() {
+				ids = append(ids, it.Record().RecordID)
+			}
+			So(it.Err(), ShouldBeNil)
+			So(ids, ShouldResemble, []string{
+				"student/1", "student/3", "student/5", "student/2",
+			})
+		})
+	})
+}
+
+// droppingDatabase drops a record from query results, like a result which
+// cannot be parsed
+type droppingDatabase struct {
+	*fake.FakeDatabase
+	dropped string
+}
+
+func (d *droppingDatabase) QueryRecordPage(query *skycontainer.Query) ([]*skyrecord.Record, int, error) {
+	recordList, count, err := d.FakeDatabase.QueryRecordPage(query)
+	var kept []*skyrecord.Record
+	for _, record := range recordList {
+		if record.RecordID != d.dropped {
+			kept = append(kept, record)
+		}
+	}
+	return kept, count, err
+}
+
+func TestCountRecords(t *testing.T) {
+	Convey("Count records", t, func() {
+		db := fake.NewFakeDatabase()
+		for _, data := range []map[string]interface{}{
+			{"_id": "student/1", "age": 10.0},
+			{"_id": "student/2", "age": 14.0},
+			{"_id": "student/3", "age": 12.0},
+		} {
+			record, _ := skyrecord.MakeRecord(data)
+			So(saveRecord(db, record, ""), ShouldBeNil)
+		}
+
+		query, err := makeQuery("student", []string{"age>=12"})
+		So(err, ShouldBeNil)
+		query.Limit = 1
+
+		count, err := db.CountRecords(query)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 2)
+	})
+}
+
+// sortRecordingDatabase records the sorts of the pages queried
+type sortRecordingDatabase struct {
+	*fake.FakeDatabase
+	sorts [][]skycontainer.Sort
+}
+
+func (d *sortRecordingDatabase) QueryRecordPage(query *skycontainer.Query) ([]*skyrecord.Record, int, error) {
+	d.sorts = append(d.sorts, query.Sorts)
+	return d.FakeDatabase.QueryRecordPage(query)
+}
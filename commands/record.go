@@ -24,6 +24,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	skycontainer "github.com/skygeario/skycli/container"
@@ -39,7 +40,18 @@ var forceConvertComplexValue bool
 var prettyPrint bool
 var recordOutputPath string
 var createWhenEdit bool
+var saveMode string
+var assignEmptyAsNull bool
+var coerceToSchema bool
 var recordUsePrivateDatabase bool
+var queryWhere stringListFlag
+var querySort string
+var queryLimit int
+var queryOffset int
+var queryAll bool
+var queryPageSize int
+var recordInclude string
+var includeAsTransient bool
 
 func formatRecordError(err skycontainer.SkygearError) error {
 	var fmtError error
@@ -177,6 +189,12 @@ func uploadAssets(db skycontainer.SkyDB, record *skyrecord.Record, recordDir str
 
 // download those assets in a record
 func downloadAssets(db skycontainer.SkyDB, record *skyrecord.Record) error {
+	return downloadAssetsTo(db, record, assetBaseDirectory, assetBaseDirectory)
+}
+
+// downloadAssetsTo download those assets in a record to dir, replacing each
+// asset with its path prefixed by pathPrefix
+func downloadAssetsTo(db skycontainer.SkyDB, record *skyrecord.Record, dir, pathPrefix string) error {
 	for idx, val := range record.Data {
 		valMap, ok := val.(map[string]interface{})
 		if !ok {
@@ -199,14 +217,14 @@ func downloadAssets(db skycontainer.SkyDB, record *skyrecord.Record) error {
 		}
 
 		var assetPath string
-		if assetBaseDirectory == "" {
+		if dir == "" {
 			assetPath = assetName
 		} else {
-			err := os.MkdirAll(assetBaseDirectory, 0755)
+			err := os.MkdirAll(dir, 0755)
 			if err != nil {
 				return err
 			}
-			assetPath = assetBaseDirectory + "/" + assetName
+			assetPath = dir + "/" + assetName
 		}
 
 		err = ioutil.WriteFile(assetPath, assetData, 0644)
@@ -214,7 +232,11 @@ func downloadAssets(db skycontainer.SkyDB, record *skyrecord.Record) error {
 			return err
 		}
 
-		record.Data[idx] = "@file:" + assetPath
+		if pathPrefix == "" {
+			record.Data[idx] = "@file:" + assetName
+		} else {
+			record.Data[idx] = "@file:" + pathPrefix + "/" + assetName
+		}
 	}
 	return nil
 }
@@ -275,6 +297,53 @@ func convertComplexValue(record *skyrecord.Record) error {
 	return nil
 }
 
+// Modes of saving records
+const (
+	// saveModeMerge keeps the attributes of the existing record not in
+	// the saved record
+	saveModeMerge = "merge"
+	// saveModeReplace removes the attributes of the existing record not
+	// in the saved record
+	saveModeReplace = "replace"
+)
+
+// checkSaveMode exits if the mode of saving records is not valid
+func checkSaveMode() {
+	if saveMode != saveModeMerge && saveMode != saveModeReplace {
+		fatal(fmt.Errorf("Unknown mode %s. Expected merge or replace.", saveMode))
+	}
+}
+
+// removeMissingKeys sets the attributes of the existing record which are
+// missing in record to null, so that they are removed when the record is
+// saved. Reserved attributes are kept. Nothing is changed if the record
+// does not exist.
+func removeMissingKeys(db skycontainer.SkyDB, record *skyrecord.Record) error {
+	current, err := db.FetchRecord(record.RecordID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	removeKeysMissingFrom(record, current)
+	return nil
+}
+
+// removeKeysMissingFrom sets the attributes of current which are missing
+// in record to null, keeping reserved attributes
+func removeKeysMissingFrom(record, current *skyrecord.Record) {
+	for key := range current.Data {
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+		if _, ok := record.Data[key]; !ok {
+			record.Data[key] = nil
+		}
+	}
+}
+
 // saveRecord save record at recordDir to db
 func saveRecord(db skycontainer.SkyDB, record *skyrecord.Record, recordDir string) error {
 	err := record.PreUploadValidate()
@@ -282,6 +351,16 @@ func saveRecord(db skycontainer.SkyDB, record *skyrecord.Record, recordDir strin
 		return err
 	}
 
+	// Missing keys are found before assets are handled, since assets
+	// skipped by --skip-asset are removed from the record but should be
+	// kept on the server
+	if saveMode == saveModeReplace {
+		err = removeMissingKeys(db, record)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = uploadAssets(db, record, recordDir)
 	if err != nil {
 		return err
@@ -300,6 +379,248 @@ func saveRecord(db skycontainer.SkyDB, record *skyrecord.Record, recordDir strin
 	return nil
 }
 
+// columnTypes returns the types of the columns of the record type in the
+// schema, keyed by the column names
+func columnTypes(db skycontainer.SkyDB, recordType string) (map[string]string, error) {
+	schema, err := db.FetchSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	types := map[string]string{}
+	for _, field := range schemaFields(schema, recordType) {
+		name, _ := field["name"].(string)
+		fieldType, _ := field["type"].(string)
+		types[name] = fieldType
+	}
+	return types, nil
+}
+
+// coerceValue converts the string value to the column type. Values of
+// other column types and complex values are not converted.
+func coerceValue(value string, columnType string) (interface{}, error) {
+	if strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+
+	switch columnType {
+	case "number":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a number", value)
+		}
+		return number, nil
+	case "integer", "sequence":
+		integer, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an integer", value)
+		}
+		return integer, nil
+	case "boolean":
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a boolean", value)
+		}
+		return boolean, nil
+	case "json":
+		var data interface{}
+		if json.Unmarshal([]byte(value), &data) == nil {
+			return data, nil
+		}
+	case "datetime":
+		return newComplexDate().Convert("@date:" + value)
+	}
+	return value, nil
+}
+
+// assignAttributes assigns the key=value and key:=json expressions to the
+// record. An empty value sets the key to null if assignEmptyAsNull is
+// true. Values of key=value are converted to the types in types if it is
+// not nil.
+func assignAttributes(record *skyrecord.Record, exprs []string, types map[string]string) error {
+	for _, expr := range exprs {
+		key, value, typed, err := skyrecord.ParseAssignment(expr)
+		if err != nil {
+			return err
+		}
+
+		if !typed && value == "" && assignEmptyAsNull {
+			err = record.Unset(key)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = record.Assign(expr)
+		if err != nil {
+			return err
+		}
+
+		columnType, ok := types[key]
+		if typed || !ok {
+			continue
+		}
+		coerced, err := coerceValue(value, columnType)
+		if err != nil {
+			return fmt.Errorf("Value of %s: %s", key, err)
+		}
+		record.Set(key, coerced)
+	}
+	return nil
+}
+
+// checkAssignments checks the assignment expressions before any records
+// are fetched, returning the paths assigned
+func checkAssignments(exprs []string) ([]string, error) {
+	var paths []string
+	for _, expr := range exprs {
+		path, value, typed, err := skyrecord.ParseAssignment(expr)
+		if err == nil {
+			err = skyrecord.CheckPath(path)
+		}
+		if err == nil && typed {
+			var data interface{}
+			if json.Unmarshal([]byte(value), &data) != nil {
+				err = fmt.Errorf("Value of %s is not valid JSON.", path)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// unsetAttributes sets the keys of the record to null
+func unsetAttributes(record *skyrecord.Record, keys []string) error {
+	for _, key := range keys {
+		err := record.Unset(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordToUpdate returns the record with the ID for saving the changes to
+// the paths. The values of the top-level keys of the nested paths are
+// copied from current, so that the nested values are changed in them.
+func recordToUpdate(recordID string, current *skyrecord.Record, paths []string) *skyrecord.Record {
+	record, _ := skyrecord.MakeEmptyRecord(recordID)
+	if current == nil {
+		return record
+	}
+
+	for _, path := range paths {
+		if !skyrecord.IsNestedPath(path) {
+			continue
+		}
+		key := skyrecord.PathKey(path)
+		value, ok := current.Data[key]
+		if !ok {
+			continue
+		}
+
+		// Copy the value so that current is not changed
+		var valueCopy interface{}
+		data, err := json.Marshal(value)
+		if err == nil && json.Unmarshal(data, &valueCopy) == nil {
+			record.Set(key, valueCopy)
+		}
+	}
+	return record
+}
+
+// hasNestedPath returns whether any of the paths is a nested path
+func hasNestedPath(paths []string) bool {
+	for _, path := range paths {
+		if skyrecord.IsNestedPath(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateRecords saves the changes made by update to the paths of the
+// record with the target ID. If target is a record type, the changes are
+// saved to each record of the type matching the --where conditions, and
+// the number of records updated is returned. Records are fetched before
+// the changes are made if any of the paths is nested.
+func updateRecords(db skycontainer.SkyDB, target string, paths []string, update func(*skyrecord.Record) error) (int, error) {
+	if strings.Contains(target, "/") {
+		if err := skyrecord.CheckRecordID(target); err != nil {
+			return 0, err
+		}
+
+		var current *skyrecord.Record
+		if hasNestedPath(paths) {
+			var err error
+			current, err = db.FetchRecord(target)
+			if skygearError, ok := err.(*skycontainer.SkygearError); ok && skygearError.Code == skycontainer.ResourceNotFound {
+				current = nil
+			} else if err != nil {
+				return 0, err
+			}
+		}
+
+		record := recordToUpdate(target, current, paths)
+		err := update(record)
+		if err == nil {
+			err = saveRecord(db, record, "")
+		}
+		if err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	if len(queryWhere) == 0 {
+		return 0, fmt.Errorf("Use --where to select the records of %s to update.", target)
+	}
+	query, err := makeQuery(target, queryWhere)
+	if err != nil {
+		return 0, err
+	}
+	query.AddAscending("_created_at")
+
+	// Records are selected before updating because the changes may
+	// affect which records match the conditions
+	var recordList []*skyrecord.Record
+	it := skycontainer.NewRecordIterator(db, query, queryPageSize)
+	for it.Next() {
+		recordList = append(recordList, it.Record())
+	}
+	if it.Err() != nil {
+		return 0, it.Err()
+	}
+
+	updated := 0
+	for _, current := range recordList {
+		record := recordToUpdate(current.RecordID, current, paths)
+		err := update(record)
+		if err == nil {
+			err = saveRecord(db, record, "")
+		}
+		if err != nil {
+			warn(fmt.Errorf("Record %s: %s", current.RecordID, err))
+			continue
+		}
+		updated++
+		recordProcessed()
+	}
+	return updated, nil
+}
+
+// printUpdatedCount prints the number of records updated if the records
+// are selected by conditions
+func printUpdatedCount(target string, count int) {
+	if !strings.Contains(target, "/") {
+		fmt.Printf("Updated %d records\n", count)
+	}
+}
+
 // fetchRecord get the record with recordID from db
 func fetchRecord(db skycontainer.SkyDB, recordID string) (*skyrecord.Record, error) {
 	err := skyrecord.CheckRecordID(recordID)
@@ -307,127 +628,263 @@ func fetchRecord(db skycontainer.SkyDB, recordID string) (*skyrecord.Record, err
 		return nil, err
 	}
 
-	record, err := db.FetchRecord(recordID)
+	var record *skyrecord.Record
+	if len(includeKeys()) > 0 {
+		record, err = fetchRecordWithInclude(db, recordID)
+	} else {
+		record, err = db.FetchRecord(recordID)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	err = record.PostDownloadHandle()
+	err = postQueryHandle(db, record)
 	if err != nil {
 		return nil, err
 	}
+	return record, nil
+}
 
-	if !skipAsset {
-		err = downloadAssets(db, record)
-		if err != nil {
-			return nil, err
+// includeKeys returns the reference attributes to be included
+func includeKeys() []string {
+	var keys []string
+	for _, key := range strings.Split(recordInclude, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
 		}
 	}
-
-	return record, nil
+	return keys
 }
 
-// fetchRecord get a record list with recordType from db
-func queryRecord(db skycontainer.SkyDB, recordType string) ([]*skyrecord.Record, error) {
-	recordList, err := db.QueryRecord(recordType)
+// fetchRecordWithInclude get the record with recordID from db, together with
+// the referenced records. Since record:fetch cannot include referenced
+// records, the record is fetched by a query.
+func fetchRecordWithInclude(db skycontainer.SkyDB, recordID string) (*skyrecord.Record, error) {
+	recordIDParts := strings.SplitN(recordID, "/", 2)
+	query := skycontainer.NewQuery(recordIDParts[0]).Equal("_id", recordIDParts[1])
+	for _, key := range includeKeys() {
+		query.Include(key)
+	}
+
+	recordList, err := db.QueryRecord(query)
 	if err != nil {
 		return nil, err
 	}
+	if len(recordList) < 1 {
+		return nil, fmt.Errorf("Record %s not found.", recordID)
+	}
+	return recordList[0], nil
+}
 
-	for idx := range recordList {
-		err = recordList[idx].PostDownloadHandle()
+// handleIncludedRecords removes `_transient` from the record, replacing the
+// references in the record with the referenced records found in it. If
+// includeAsTransient is set, the references are kept and the included
+// records are returned instead, to be restored by restoreIncludedRecords.
+func handleIncludedRecords(record *skyrecord.Record) map[string]interface{} {
+	transient, ok := record.Data["_transient"].(map[string]interface{})
+	delete(record.Data, "_transient")
+	if !ok {
+		return nil
+	}
 
-		if !skipAsset {
-			err = downloadAssets(db, recordList[idx])
-			if err != nil {
-				warn(err)
-				continue
+	for key, val := range transient {
+		included, ok := val.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		// Remove reserved keys other than _id as in PostDownloadHandle
+		for k := range included {
+			if strings.HasPrefix(k, "_") && k != "_id" {
+				delete(included, k)
 			}
 		}
+
+		if !includeAsTransient {
+			record.Data[key] = included
+		}
 	}
 
-	return recordList, nil
+	if includeAsTransient {
+		return transient
+	}
+	return nil
 }
 
-// printRecordList print the record list to outputFile.
-// It would print to stdout if outputFile is not provided.
-func printRecordList(recordList []*skyrecord.Record) (err error) {
-	var outputFile *os.File
-	if recordOutputPath == "" {
-		outputFile = os.Stdout
-	} else {
-		outputFile, err = os.OpenFile(recordOutputPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+// restoreIncludedRecords puts the included records back to `_transient`
+// after reserved keys are removed by PostDownloadHandle
+func restoreIncludedRecords(record *skyrecord.Record, transient map[string]interface{}) {
+	if transient != nil {
+		record.Data["_transient"] = transient
+	}
+}
+
+// postQueryHandle processes a record returned from a fetch or a query
+func postQueryHandle(db skycontainer.SkyDB, record *skyrecord.Record) error {
+	transient := handleIncludedRecords(record)
+
+	err := record.PostDownloadHandle()
+	if err != nil {
+		return err
+	}
+	restoreIncludedRecords(record, transient)
+
+	// Complex values are rendered before assets are downloaded, so that
+	// the paths of the assets are not rendered as strings
+	if shorthandOutput {
+		renderComplexValues(record)
+	}
+
+	if !skipAsset {
+		err = downloadAssets(db, record)
 		if err != nil {
 			return err
 		}
-		defer outputFile.Close()
+	}
+	return nil
+}
+
+// queryRecord get a record list matching the query from db
+func queryRecord(db skycontainer.SkyDB, query *skycontainer.Query) ([]*skyrecord.Record, error) {
+	recordList, err := db.QueryRecord(query)
+	if err != nil {
+		return nil, err
 	}
 
 	for _, record := range recordList {
-		var resultBytes []byte
-		if prettyPrint {
-			resultBytes, err = record.PrettyPrintBytes()
-		} else {
-			resultBytes, err = json.Marshal(record)
-		}
+		err = postQueryHandle(db, record)
 		if err != nil {
 			warn(err)
 			continue
 		}
+	}
 
-		_, err = outputFile.Write(resultBytes)
+	return recordList, nil
+}
+
+// createRecordOutput opens the file for printing records, which is
+// stdout if recordOutputPath is not provided.
+func createRecordOutput() (*os.File, error) {
+	if recordOutputPath == "" {
+		return os.Stdout, nil
+	}
+	return os.OpenFile(recordOutputPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+func closeRecordOutput(outputFile *os.File) {
+	if outputFile != os.Stdout {
+		outputFile.Close()
+	}
+}
+
+// writeRecord writes a record followed by a newline to w
+func writeRecord(w io.Writer, record *skyrecord.Record) (err error) {
+	var resultBytes []byte
+	if prettyPrint {
+		resultBytes, err = record.PrettyPrintBytes()
+	} else {
+		resultBytes, err = json.Marshal(record)
+	}
+	if err != nil {
+		return err
+	}
+
+	resultBytes = append(resultBytes, '\n')
+	_, err = w.Write(resultBytes)
+	return err
+}
+
+// printRecordList print the record list to outputFile.
+// It would print to stdout if outputFile is not provided.
+func printRecordList(recordList []*skyrecord.Record) error {
+	outputFile, err := createRecordOutput()
+	if err != nil {
+		return err
+	}
+	defer closeRecordOutput(outputFile)
+
+	for _, record := range recordList {
+		err = writeRecord(outputFile, record)
 		if err != nil {
 			warn(err)
 			continue
 		}
+		recordProcessed()
+	}
+
+	return nil
+}
+
+// printAllQueryRecord print all records matching the query page by page,
+// so that records are not kept in memory
+func printAllQueryRecord(db skycontainer.SkyDB, query *skycontainer.Query) error {
+	outputFile, err := createRecordOutput()
+	if err != nil {
+		return err
+	}
+	defer closeRecordOutput(outputFile)
+
+	it := skycontainer.NewRecordIterator(db, query, queryPageSize)
+	for it.Next() {
+		record := it.Record()
+		err = postQueryHandle(db, record)
+		if err != nil {
+			warn(err)
+		}
 
-		_, err = outputFile.WriteString("\n")
+		err = writeRecord(outputFile, record)
 		if err != nil {
 			warn(err)
 			continue
 		}
+		recordProcessed()
 	}
 
-	return nil
+	return it.Err()
 }
 
 var recordImportCmd = &cobra.Command{
 	Use:   "import [<path> ...]",
 	Short: "Import records to database",
 	Run: func(cmd *cobra.Command, args []string) {
-		db := newDatabase()
+		checkSaveMode()
+		db := newDatabaseForWrite()
 
-		// Stdin
-		if len(args) == 0 {
-			for r := range getRecordList(os.Stdin) {
-				err := saveRecord(db, r, "")
-				if err != nil {
-					warn(err)
-					continue
-				}
+		journalPath, err := importJournalFilePath(args)
+		if err != nil {
+			fatal(err)
+		}
+
+		// Nothing is imported in dry-run mode, so there is no progress to
+		// be recorded
+		var journal *importJournal
+		if journalPath != "" && !dryRun {
+			journal, err = openImportJournal(journalPath, importResume)
+			if err != nil {
+				fatal(fmt.Errorf("Unable to open import journal: %s", err))
 			}
-		} else {
-			for _, path := range args {
-				for filename := range getImportPathList(path) {
-					f, err := os.Open(filename)
-					if err != nil {
-						warn(err)
-						continue
-					}
-					defer f.Close()
+		}
 
-					recordPath := filepath.Dir(filename)
+		stats := importRecords(db, args, journal)
+		exitIfInterrupted()
 
-					for r := range getRecordList(f) {
-						err := saveRecord(db, r, recordPath)
-						if err != nil {
-							warn(err)
-							continue
-						}
-					}
-				}
+		// The journal is kept for resuming the import if some records failed
+		if journal != nil {
+			err := journal.close(stats.Failed == 0)
+			if err != nil {
+				warn(err)
 			}
 		}
+
+		if stats.Skipped > 0 {
+			fmt.Printf("Imported %d records, %d failed, %d skipped\n", stats.Saved, stats.Failed, stats.Skipped)
+		} else {
+			fmt.Printf("Imported %d records, %d failed\n", stats.Saved, stats.Failed)
+		}
+		if stats.Failed > 0 && journal != nil {
+			fmt.Fprintf(os.Stderr, "Run the import again with --resume --journal %s to retry the failed records.\n", journal.path)
+		}
 	},
 }
 
@@ -440,10 +897,12 @@ var recordGetCmd = &cobra.Command{
 		db := newDatabase()
 
 		var recordList []*skyrecord.Record
+		var fetchErr error
 		for _, recordID := range args {
 			record, err := fetchRecord(db, recordID)
 			if err != nil {
 				warn(err)
+				fetchErr = err
 				continue
 			}
 
@@ -451,6 +910,11 @@ var recordGetCmd = &cobra.Command{
 		}
 
 		printRecordList(recordList)
+
+		// Records found are printed even if some are not found
+		if fetchErr != nil {
+			os.Exit(exitCode(fetchErr))
+		}
 	},
 }
 
@@ -461,7 +925,7 @@ var recordDeleteCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		checkMinArgCount(cmd, args, 1)
 
-		db := newDatabase()
+		db := newDatabaseForWrite()
 
 		for _, arg := range args {
 			if err := skyrecord.CheckRecordID(arg); err != nil {
@@ -477,33 +941,67 @@ var recordDeleteCmd = &cobra.Command{
 }
 
 var recordSetCmd = &cobra.Command{
-	Use:   "set <record_id> <key=value> [<key=value> ...]",
-	Short: "Set attributes on a record",
+	Use:   "set (<record_id>|<record_type> --where <condition>) <key=value> [<key=value> ...]",
+	Short: "Set attributes on records",
+	Long: `Set attributes on the record with the ID, or on each record of the record type matching the conditions.
+Values of key=value are strings. Values of key:=value are parsed as JSON (e.g. age:=10, tags:='["a","b"]').
+An empty value (key=) sets the attribute to an empty string, or to null with --null.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		checkMinArgCount(cmd, args, 2)
+		checkSaveMode()
 
-		modifyRecord, err := skyrecord.MakeEmptyRecord(args[0])
+		paths, err := checkAssignments(args[1:])
 		if err != nil {
 			fatal(err)
 		}
 
-		for _, arg := range args[1:] {
-			err := modifyRecord.Assign(arg)
+		db := newDatabaseForWrite()
+
+		var types map[string]string
+		if coerceToSchema {
+			recordType := strings.SplitN(args[0], "/", 2)[0]
+			types, err = columnTypes(db, recordType)
 			if err != nil {
 				fatal(err)
 			}
 		}
 
-		db := newDatabase()
-		err = saveRecord(db, modifyRecord, "")
+		count, err := updateRecords(db, args[0], paths, func(record *skyrecord.Record) error {
+			return assignAttributes(record, args[1:], types)
+		})
 		if err != nil {
 			fatal(err)
 		}
+		printUpdatedCount(args[0], count)
+	},
+}
+
+var recordUnsetCmd = &cobra.Command{
+	Use:   "unset (<record_id>|<record_type> --where <condition>) <key> [<key> ...]",
+	Short: "Remove attributes from records",
+	Long:  "Set attributes of the record with the ID, or of each record of the record type matching the conditions, to null.",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMinArgCount(cmd, args, 2)
+
+		for _, path := range args[1:] {
+			if err := skyrecord.CheckPath(path); err != nil {
+				fatal(err)
+			}
+		}
+
+		db := newDatabaseForWrite()
+		count, err := updateRecords(db, args[0], args[1:], func(record *skyrecord.Record) error {
+			return unsetAttributes(record, args[1:])
+		})
+		if err != nil {
+			fatal(err)
+		}
+		printUpdatedCount(args[0], count)
 	},
 }
 
 var recordGetAttrCmd = &cobra.Command{
-	Use:   "getattr <record_id> <key>",
+	Use:   "getattr <record_id> <path>",
 	Short: "Get value of a record attribute",
 	Run: func(cmd *cobra.Command, args []string) {
 		checkMinArgCount(cmd, args, 2)
@@ -518,7 +1016,7 @@ var recordGetAttrCmd = &cobra.Command{
 			fatal(err)
 		}
 
-		desiredValue, err := record.Get(desiredKey)
+		desiredValue, err := record.GetPath(desiredKey)
 		if err != nil {
 			fatal(err)
 		}
@@ -581,8 +1079,9 @@ var recordEditCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		checkMinArgCount(cmd, args, 1)
 		checkMaxArgCount(cmd, args, 1)
+		checkSaveMode()
 
-		db := newDatabase()
+		db := newDatabaseForWrite()
 		recordID := args[0]
 
 		if strings.Contains(recordID, "/") {
@@ -627,12 +1126,32 @@ var recordQueryCmd = &cobra.Command{
 		checkMaxArgCount(cmd, args, 1)
 
 		db := newDatabase()
-		recordType := args[0]
-		if strings.Contains(recordType, "/") {
-			fatal(fmt.Errorf("Record type cannot contain '/'."))
+		query, err := makeQuery(args[0], queryWhere)
+		if err != nil {
+			fatal(err)
+		}
+
+		if querySort != "" {
+			err = parseSort(query, querySort)
+			if err != nil {
+				fatal(err)
+			}
+		}
+		query.Limit = queryLimit
+		query.Offset = queryOffset
+		for _, key := range includeKeys() {
+			query.Include(key)
 		}
 
-		recordList, err := queryRecord(db, recordType)
+		if queryAll {
+			err = printAllQueryRecord(db, query)
+			if err != nil {
+				fatal(err)
+			}
+			return
+		}
+
+		recordList, err := queryRecord(db, query)
 		if err != nil {
 			fatal(err)
 		}
@@ -644,6 +1163,28 @@ var recordQueryCmd = &cobra.Command{
 	},
 }
 
+var recordCountCmd = &cobra.Command{
+	Use:   "count <record_type>",
+	Short: "Count records in database",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMinArgCount(cmd, args, 1)
+		checkMaxArgCount(cmd, args, 1)
+
+		db := newDatabase()
+		query, err := makeQuery(args[0], queryWhere)
+		if err != nil {
+			fatal(err)
+		}
+
+		count, err := db.CountRecords(query)
+		if err != nil {
+			fatal(err)
+		}
+
+		fmt.Println(count)
+	},
+}
+
 func init() {
 	recordCmd.PersistentFlags().BoolVarP(&recordUsePrivateDatabase, "private", "p", false, "Database. Default is Public.")
 	viper.BindPFlag("use_private_database", recordCmd.PersistentFlags().Lookup("private"))
@@ -651,31 +1192,60 @@ func init() {
 	recordImportCmd.Flags().BoolVar(&skipAsset, "skip-asset", false, "Do not upload assets")
 	recordImportCmd.Flags().StringVarP(&assetBaseDirectory, "basedir", "d", "", "Base path for locating asset files to be uploaded")
 	recordImportCmd.Flags().BoolVarP(&forceConvertComplexValue, "no-warn-complex", "i", false, "Ignore complex values conversion warnings and convert automatically.")
+	recordImportCmd.Flags().StringVar(&saveMode, "mode", saveModeMerge, "How existing records are updated: merge keeps attributes not in the file, replace removes them")
+	recordImportCmd.Flags().IntVar(&importConcurrency, "concurrency", 4, "Number of requests to make at the same time")
+	recordImportCmd.Flags().IntVar(&importBatchSize, "batch-size", 50, "Number of records to save in each request")
+	recordImportCmd.Flags().BoolVar(&importResume, "resume", false, "Skip records and assets already imported according to the journal (default journal "+defaultImportJournalPath+")")
+	recordImportCmd.Flags().StringVar(&importJournalPath, "journal", "", "Path to the journal recording the progress of the import")
 
 	recordGetCmd.Flags().BoolVar(&skipAsset, "skip-asset", false, "download assets")
 	recordGetCmd.Flags().StringVarP(&assetBaseDirectory, "basedir", "d", "", "Base path for asset files to be downloaded")
 	recordGetCmd.Flags().BoolVar(&prettyPrint, "pretty-print", false, "Print output in a pretty format")
+	recordGetCmd.Flags().BoolVar(&shorthandOutput, "shorthand", false, "Print complex values in simpler forms (e.g. @loc:<lat>,<lng>) accepted by record import")
 	recordGetCmd.Flags().StringVarP(&recordOutputPath, "output", "o", "", "Path to save the output to. If not specified, output is printed to stdout with newline delimiter.")
 
+	recordGetCmd.Flags().StringVar(&recordInclude, "include", "", "Comma-separated reference keys whose referenced records are fetched and inlined")
+	recordGetCmd.Flags().BoolVar(&includeAsTransient, "transient", false, "Write included records into _transient instead of inlining them")
+
+	recordSetCmd.Flags().Var(&queryWhere, "where", "Condition on the records of the record type to update (e.g. 'age>10'). Can be specified multiple times.")
+	recordSetCmd.Flags().BoolVar(&coerceToSchema, "coerce", false, "Convert values of key=value to the types of the columns in the schema")
+	recordSetCmd.Flags().BoolVar(&assignEmptyAsNull, "null", false, "Set attributes assigned with an empty value (key=) to null")
+	recordSetCmd.Flags().StringVar(&saveMode, "mode", saveModeMerge, "How the existing record is updated: merge keeps other attributes, replace removes them")
 	recordSetCmd.Flags().BoolVar(&skipAsset, "skip-asset", false, "Do not upload assets")
 	recordSetCmd.Flags().StringVarP(&assetBaseDirectory, "basedir", "d", "", "Base path for locating files to be uploaded")
 	recordSetCmd.Flags().BoolVarP(&forceConvertComplexValue, "no-warn-complex", "i", false, "Ignore complex values conversion warnings and convert automatically.")
 
+	recordUnsetCmd.Flags().Var(&queryWhere, "where", "Condition on the records of the record type to update (e.g. 'age>10'). Can be specified multiple times.")
+
 	recordGetAttrCmd.Flags().StringVarP(&assetBaseDirectory, "basedir", "d", "", "Base path for asset files to be downloaded.")
 	recordGetAttrCmd.Flags().BoolVar(&skipAsset, "skip-asset", false, "Do not download asset.")
 
+	recordEditCmd.Flags().StringVar(&saveMode, "mode", saveModeMerge, "How the record is updated: merge keeps attributes removed in the editor, replace removes them")
 	recordEditCmd.Flags().BoolVarP(&createWhenEdit, "new", "n", false, "Do not fetch record from database before editing")
 
 	recordQueryCmd.Flags().BoolVar(&skipAsset, "skip-asset", false, "Do not download assets")
 	recordQueryCmd.Flags().StringVarP(&assetBaseDirectory, "basedir", "d", "", "Base path for asset files to be downloaded")
 	recordQueryCmd.Flags().BoolVar(&prettyPrint, "pretty-print", false, "Print output in a pretty format")
+	recordQueryCmd.Flags().BoolVar(&shorthandOutput, "shorthand", false, "Print complex values in simpler forms (e.g. @loc:<lat>,<lng>) accepted by record import")
 	recordQueryCmd.Flags().StringVarP(&recordOutputPath, "output", "o", "", "Path to save the output to. If not specified, output is printed to stdout with newline delimiter.")
+	recordQueryCmd.Flags().Var(&queryWhere, "where", "Condition on the records to query (e.g. 'age>10'). Can be specified multiple times.")
+	recordQueryCmd.Flags().StringVar(&querySort, "sort", "", "Comma-separated keys to sort the records by. Prefix a key with '-' to sort in descending order.")
+	recordQueryCmd.Flags().IntVar(&queryLimit, "limit", 0, "Maximum number of records to query. Default is the server default.")
+	recordQueryCmd.Flags().IntVar(&queryOffset, "offset", 0, "Number of records to skip")
+	recordQueryCmd.Flags().BoolVar(&queryAll, "all", false, "Query all records page by page, instead of only the first page")
+	recordQueryCmd.Flags().StringVar(&recordInclude, "include", "", "Comma-separated reference keys whose referenced records are fetched and inlined")
+	recordQueryCmd.Flags().BoolVar(&includeAsTransient, "transient", false, "Write included records into _transient instead of inlining them")
+	recordQueryCmd.Flags().IntVar(&queryPageSize, "page-size", skycontainer.DefaultPageSize, "Number of records to query in each page when --all is specified")
+
+	recordCountCmd.Flags().Var(&queryWhere, "where", "Condition on the records to count (e.g. 'age>10'). Can be specified multiple times.")
 
 	recordCmd.AddCommand(recordImportCmd)
 	recordCmd.AddCommand(recordGetCmd)
 	recordCmd.AddCommand(recordDeleteCmd)
 	recordCmd.AddCommand(recordSetCmd)
+	recordCmd.AddCommand(recordUnsetCmd)
 	recordCmd.AddCommand(recordGetAttrCmd)
 	recordCmd.AddCommand(recordEditCmd)
 	recordCmd.AddCommand(recordQueryCmd)
+	recordCmd.AddCommand(recordCountCmd)
 }
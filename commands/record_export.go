@@ -0,0 +1,164 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	skyrecord "github.com/skygeario/skycli/record"
+	"github.com/spf13/cobra"
+)
+
+var exportOutputDir string
+
+// exportFilename returns the name of the file a record or a record type
+// is exported to, e.g. city/hongkong is exported to city-hongkong.json
+func exportFilename(name string) string {
+	return strings.Replace(name, "/", "-", -1) + ".json"
+}
+
+// exportAssets downloads the assets of the record to dir. Assets are
+// replaced with paths relative to dir so that the exported file can be
+// imported again.
+func exportAssets(db skycontainer.SkyDB, record *skyrecord.Record, dir string) error {
+	if skipAsset {
+		return nil
+	}
+	return downloadAssetsTo(db, record, dir, "")
+}
+
+// exportRecord exports the record with recordID to its own file in dir
+func exportRecord(db skycontainer.SkyDB, recordID string, dir string) error {
+	err := skyrecord.CheckRecordID(recordID)
+	if err != nil {
+		return err
+	}
+
+	record, err := db.FetchRecord(recordID)
+	if err != nil {
+		return err
+	}
+
+	err = record.PostDownloadHandle()
+	if err != nil {
+		return err
+	}
+	if shorthandOutput {
+		renderComplexValues(record)
+	}
+
+	err = exportAssets(db, record, dir)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, exportFilename(recordID)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = writeRecord(f, record)
+	if err == nil {
+		recordProcessed()
+	}
+	return err
+}
+
+// exportRecordType exports all records of the record type to a single
+// file in dir, with one record per line
+func exportRecordType(db skycontainer.SkyDB, recordType string, dir string) error {
+	query, err := makeQuery(recordType, queryWhere)
+	if err != nil {
+		return err
+	}
+	// Sort by creation time so that records are paged consistently
+	query.AddAscending("_created_at")
+
+	f, err := os.Create(filepath.Join(dir, exportFilename(recordType)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	it := skycontainer.NewRecordIterator(db, query, queryPageSize)
+	for it.Next() {
+		record := it.Record()
+		err = record.PostDownloadHandle()
+		if err != nil {
+			warn(err)
+			continue
+		}
+		if shorthandOutput {
+			renderComplexValues(record)
+		}
+
+		err = exportAssets(db, record, dir)
+		if err != nil {
+			warn(err)
+		}
+
+		err = writeRecord(f, record)
+		if err != nil {
+			return err
+		}
+		recordProcessed()
+	}
+
+	return it.Err()
+}
+
+var recordExportCmd = &cobra.Command{
+	Use:   "export (<record_id>|<record_type>) [(<record_id>|<record_type>) ...]",
+	Short: "Export records and their assets to files",
+	Long: `Each specified record is exported to its own file, named after the record ID.
+All records of each specified record type are exported to a single file, with one record per line.
+Assets are downloaded next to the exported files so that they can be imported by "record import".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkMinArgCount(cmd, args, 1)
+
+		err := os.MkdirAll(exportOutputDir, 0755)
+		if err != nil {
+			fatal(err)
+		}
+
+		db := newDatabase()
+		for _, arg := range args {
+			if strings.Contains(arg, "/") {
+				err = exportRecord(db, arg, exportOutputDir)
+			} else {
+				err = exportRecordType(db, arg, exportOutputDir)
+			}
+			if err != nil {
+				warn(err)
+				continue
+			}
+		}
+	},
+}
+
+func init() {
+	recordExportCmd.Flags().StringVarP(&exportOutputDir, "output", "o", ".", "Directory to save the exported files to")
+	recordExportCmd.Flags().BoolVar(&skipAsset, "skip-asset", false, "Do not download assets")
+	recordExportCmd.Flags().BoolVar(&prettyPrint, "pretty-print", false, "Print output in a pretty format")
+	recordExportCmd.Flags().BoolVar(&shorthandOutput, "shorthand", false, "Write complex values in simpler forms (e.g. @loc:<lat>,<lng>) accepted by record import")
+	recordExportCmd.Flags().Var(&queryWhere, "where", "Condition on the records of record types to export (e.g. 'age>10'). Can be specified multiple times.")
+	recordExportCmd.Flags().IntVar(&queryPageSize, "page-size", skycontainer.DefaultPageSize, "Number of records to query in each page")
+
+	recordCmd.AddCommand(recordExportCmd)
+}
@@ -0,0 +1,85 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fake "github.com/skygeario/skycli/container/fakecontainer"
+	skyrecord "github.com/skygeario/skycli/record"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExportRecord(t *testing.T) {
+	Convey("Export Record", t, func() {
+		skipAsset = false
+		db := fake.NewFakeDatabase()
+		db.AssetList["asset-hongkong.jpg"] = []byte("hongkong")
+
+		for _, data := range []map[string]interface{}{
+			{
+				"_id":  "city/hongkong",
+				"name": "Hong Kong",
+				"image": map[string]interface{}{
+					"$type": "asset",
+					"$name": "asset-hongkong.jpg",
+					"$url":  "asset-hongkong.jpg",
+				},
+			},
+			{"_id": "city/paris", "name": "Paris"},
+		} {
+			record, _ := skyrecord.MakeRecord(data)
+			So(db.SaveRecord(record), ShouldBeNil)
+		}
+
+		dir, err := ioutil.TempDir("", "skycli")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		Convey("exports a record with asset", func() {
+			err := exportRecord(db, "city/hongkong", dir)
+			So(err, ShouldBeNil)
+
+			data, err := ioutil.ReadFile(filepath.Join(dir, "city-hongkong.json"))
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual,
+				`{"_id":"city/hongkong","image":"@file:asset-hongkong.jpg","name":"Hong Kong"}`+"\n")
+
+			asset, err := ioutil.ReadFile(filepath.Join(dir, "asset-hongkong.jpg"))
+			So(err, ShouldBeNil)
+			So(string(asset), ShouldEqual, "hongkong")
+		})
+
+		Convey("exports a record type", func() {
+			err := exportRecordType(db, "city", dir)
+			So(err, ShouldBeNil)
+
+			f, err := os.Open(filepath.Join(dir, "city.json"))
+			So(err, ShouldBeNil)
+			defer f.Close()
+
+			var recordList []*skyrecord.Record
+			for r := range getRecordList(f) {
+				recordList = append(recordList, r)
+			}
+			So(len(recordList), ShouldEqual, 2)
+			So(recordList[0].Data["image"], ShouldEqual, "@file:asset-hongkong.jpg")
+			So(recordList[1].RecordID, ShouldEqual, "city/paris")
+		})
+	})
+}
@@ -0,0 +1,296 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	skyrecord "github.com/skygeario/skycli/record"
+)
+
+var importConcurrency int
+var importBatchSize int
+
+// importItem is a record to be imported
+type importItem struct {
+	record *skyrecord.Record
+	// recordDir is the directory of the file containing the record,
+	// which asset paths are relative to
+	recordDir string
+	// source and index locate the record in the imported files
+	source string
+	index  int
+}
+
+// importStats counts the imported records
+type importStats struct {
+	mutex   sync.Mutex
+	Saved   int
+	Failed  int
+	Skipped int
+}
+
+func (s *importStats) add(saved, failed int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Saved += saved
+	s.Failed += failed
+}
+
+// recordImporter imports records to db, recording the progress in
+// journal if it is not nil
+type recordImporter struct {
+	db      skycontainer.SkyDB
+	journal *importJournal
+	stats   importStats
+	// requests limits the number of requests made at the same time to
+	// importConcurrency
+	requests chan struct{}
+}
+
+// importSource sends the records in the file at path to items. Records
+// are read from stdin if path is empty.
+func (im *recordImporter) importSource(path string, items chan<- importItem) {
+	f := os.Stdin
+	recordDir := ""
+	source := stdinSource
+	if path != "" {
+		var err error
+		f, err = os.Open(path)
+		if err != nil {
+			warn(err)
+			return
+		}
+		defer f.Close()
+		recordDir = filepath.Dir(path)
+		source, err = filepath.Abs(path)
+		if err != nil {
+			warn(err)
+			return
+		}
+	}
+
+	index := -1
+	for record := range getRecordList(f) {
+		index++
+		if im.journal != nil && im.journal.recordImported(source, index) {
+			im.stats.Skipped++
+			continue
+		}
+
+		// Records are prepared one by one because converting complex
+		// values may prompt for confirmation
+		err := record.PreUploadValidate()
+		if err == nil {
+			err = convertComplexValue(record)
+		}
+		if err != nil {
+			warn(fmt.Errorf("Record %s: %s", record.RecordID, err))
+			im.stats.add(0, 1)
+			continue
+		}
+
+		items <- importItem{record, recordDir, source, index}
+	}
+}
+
+// batchImportItems groups the items into batches of importBatchSize
+func batchImportItems(items <-chan importItem) <-chan []importItem {
+	batches := make(chan []importItem)
+	go func() {
+		defer close(batches)
+
+		var batch []importItem
+		for item := range items {
+			batch = append(batch, item)
+			if len(batch) >= importBatchSize {
+				batches <- batch
+				batch = nil
+			}
+		}
+		if len(batch) > 0 {
+			batches <- batch
+		}
+	}()
+	return batches
+}
+
+// removeBatchMissingKeys fetches the existing records of the batch in a
+// single request, and sets their attributes missing in the batch to be
+// removed like removeMissingKeys. The errors are returned in the order of
+// the batch.
+func (im *recordImporter) removeBatchMissingKeys(db skycontainer.SkyDB, batch []importItem) []error {
+	recordIDList := make([]string, len(batch))
+	for i, item := range batch {
+		recordIDList[i] = item.record.RecordID
+	}
+
+	im.requests <- struct{}{}
+	currentList, errs, err := db.FetchRecords(recordIDList)
+	<-im.requests
+	if err != nil {
+		errs = make([]error, len(batch))
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	for i, item := range batch {
+		if isNotFound(errs[i]) {
+			errs[i] = nil
+			continue
+		}
+		if errs[i] == nil {
+			removeKeysMissingFrom(item.record, currentList[i])
+		}
+	}
+	return errs
+}
+
+// prepareBatch uploads the assets of the records in the batch
+// concurrently, returning the errors in the order of the batch. In replace
+// mode, attributes of the existing records missing in the batch are also
+// set to be removed, before assets skipped by --skip-asset are removed
+// from the records.
+func (im *recordImporter) prepareBatch(db skycontainer.SkyDB, batch []importItem) []error {
+	errs := make([]error, len(batch))
+	if saveMode == saveModeReplace {
+		errs = im.removeBatchMissingKeys(db, batch)
+	}
+
+	var wg sync.WaitGroup
+	for i, item := range batch {
+		if errs[i] != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, item importItem) {
+			defer wg.Done()
+			im.requests <- struct{}{}
+			defer func() { <-im.requests }()
+
+			errs[i] = uploadAssets(db, item.record, item.recordDir)
+		}(i, item)
+	}
+	wg.Wait()
+	return errs
+}
+
+// importBatch saves the records in the batch in a single request
+func (im *recordImporter) importBatch(batch []importItem) {
+	db := im.db
+	if im.journal != nil {
+		db = &journalDatabase{db, im.journal}
+	}
+
+	failed := 0
+	var saving []importItem
+	var recordList []*skyrecord.Record
+	for i, err := range im.prepareBatch(db, batch) {
+		if err != nil {
+			warn(fmt.Errorf("Record %s: %s", batch[i].record.RecordID, err))
+			failed++
+			continue
+		}
+		saving = append(saving, batch[i])
+		recordList = append(recordList, batch[i].record)
+	}
+
+	if len(recordList) == 0 {
+		im.stats.add(0, failed)
+		return
+	}
+
+	im.requests <- struct{}{}
+	errs, err := db.SaveRecords(recordList)
+	<-im.requests
+	if err != nil {
+		warn(fmt.Errorf("Unable to save %d records: %s", len(recordList), err))
+		im.stats.add(0, failed+len(recordList))
+		return
+	}
+
+	saved := 0
+	for i, err := range errs {
+		if err != nil {
+			warn(err)
+			failed++
+			continue
+		}
+		saved++
+		recordProcessed()
+
+		if im.journal != nil {
+			err = im.journal.addRecord(saving[i].source, saving[i].index)
+			if err != nil {
+				warn(err)
+			}
+		}
+	}
+	im.stats.add(saved, failed)
+}
+
+// importRecords imports the records in the files at paths, or from stdin
+// if no path is given. Batches of records are saved by importConcurrency
+// workers concurrently, making at most importConcurrency requests at the
+// same time. Progress is recorded in journal if it is not nil,
+// and records already imported according to it are skipped.
+func importRecords(db skycontainer.SkyDB, paths []string, journal *importJournal) *importStats {
+	concurrency := importConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	im := &recordImporter{
+		db:       db,
+		journal:  journal,
+		requests: make(chan struct{}, concurrency),
+	}
+	items := make(chan importItem)
+	go func() {
+		defer close(items)
+
+		if len(paths) == 0 {
+			im.importSource("", items)
+			return
+		}
+		for _, path := range paths {
+			for filename := range getImportPathList(path) {
+				im.importSource(filename, items)
+			}
+		}
+	}()
+
+	batches := batchImportItems(items)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				im.importBatch(batch)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return &im.stats
+}
@@ -0,0 +1,320 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	fake "github.com/skygeario/skycli/container/fakecontainer"
+	skyrecord "github.com/skygeario/skycli/record"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestImportRecords(t *testing.T) {
+	Convey("Import records", t, func() {
+		skipAsset = false
+		assetBaseDirectory = ""
+		forceConvertComplexValue = true
+		importConcurrency = 2
+		importBatchSize = 3
+		defer func() {
+			forceConvertComplexValue = false
+		}()
+
+		dir, err := ioutil.TempDir("", "skycli")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var content bytes.Buffer
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(&content, `{"_id": "note/%d", "index": %d}`+"\n", i, i)
+		}
+		content.WriteString(`{"_id": "note/asset", "attachment": "@file:asset.txt"}` + "\n")
+		content.WriteString(`{"_id": "note/ref", "parent": "@ref:note/0"}` + "\n")
+		content.WriteString(`{"_id": "invalid"}` + "\n")
+		So(ioutil.WriteFile(filepath.Join(dir, "note.json"), content.Bytes(), 0644), ShouldBeNil)
+
+		db := fake.NewFakeDatabase()
+		stats := importRecords(db, []string{dir}, nil)
+		So(stats.Saved, ShouldEqual, 12)
+		So(stats.Failed, ShouldEqual, 1)
+
+		So(db.RecordList["note"], ShouldHaveLength, 12)
+		So(db.RecordList["note"]["9"].Data["index"], ShouldEqual, 9)
+		attachment, ok := db.RecordList["note"]["asset"].Data["attachment"].(map[string]interface{})
+		So(ok, ShouldBeTrue)
+		So(attachment["$type"], ShouldEqual, "asset")
+		So(db.RecordList["note"]["ref"].Data["parent"], ShouldResemble, map[string]interface{}{
+			"$type": "ref",
+			"$id":   "note/0",
+		})
+	})
+}
+
+// requestCountingDatabase records the largest number of assets and records
+// saved at the same time
+type requestCountingDatabase struct {
+	*fake.FakeDatabase
+	mutex    sync.Mutex
+	requests int
+	max      int
+}
+
+func (d *requestCountingDatabase) request() func() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.requests++
+	if d.requests > d.max {
+		d.max = d.requests
+	}
+	return func() {
+		time.Sleep(time.Millisecond)
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		d.requests--
+	}
+}
+
+func (d *requestCountingDatabase) SaveAsset(path string) (string, error) {
+	defer d.request()()
+	return d.FakeDatabase.SaveAsset(path)
+}
+
+func (d *requestCountingDatabase) SaveRecords(recordList []*skyrecord.Record) ([]error, error) {
+	defer d.request()()
+	return d.FakeDatabase.SaveRecords(recordList)
+}
+
+func TestImportConcurrency(t *testing.T) {
+	Convey("Import records with limited concurrency", t, func() {
+		skipAsset = false
+		assetBaseDirectory = ""
+		forceConvertComplexValue = true
+		importConcurrency = 2
+		importBatchSize = 5
+		defer func() {
+			forceConvertComplexValue = false
+		}()
+
+		dir, err := ioutil.TempDir("", "skycli")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var content bytes.Buffer
+		for i := 0; i < 20; i++ {
+			fmt.Fprintf(&content, `{"_id": "note/%d", "attachment": "@file:%d.txt"}`+"\n", i, i)
+		}
+		So(ioutil.WriteFile(filepath.Join(dir, "note.json"), content.Bytes(), 0644), ShouldBeNil)
+
+		db := &requestCountingDatabase{FakeDatabase: fake.NewFakeDatabase()}
+		stats := importRecords(db, []string{dir}, nil)
+		So(stats.Saved, ShouldEqual, 20)
+		So(db.AssetList, ShouldHaveLength, 20)
+		So(db.max, ShouldBeBetweenOrEqual, 1, 2)
+	})
+}
+
+func TestResumeImport(t *testing.T) {
+	Convey("Resume import with journal", t, func() {
+		skipAsset = false
+		assetBaseDirectory = ""
+		forceConvertComplexValue = true
+		importConcurrency = 1
+		importBatchSize = 1
+		defer func() {
+			forceConvertComplexValue = false
+		}()
+
+		dir, err := ioutil.TempDir("", "skycli")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		content := `{"_id": "note/0", "attachment": "@file:asset.txt"}
+{"_id": "note/1", "attachment": "@file:asset.txt"}
+{"_id": "note/2"}
+`
+		recordPath := filepath.Join(dir, "note.json")
+		journalPath := filepath.Join(dir, "journal")
+		So(ioutil.WriteFile(recordPath, []byte(content), 0644), ShouldBeNil)
+
+		journal, err := openImportJournal(journalPath, false)
+		So(err, ShouldBeNil)
+		db := fake.NewFakeDatabase()
+		stats := importRecords(db, []string{recordPath}, journal)
+		So(stats.Saved, ShouldEqual, 3)
+		So(journal.close(false), ShouldBeNil)
+		So(db.AssetList, ShouldHaveLength, 1)
+
+		Convey("skips imported records", func() {
+			journal, err := openImportJournal(journalPath, true)
+			So(err, ShouldBeNil)
+			defer journal.close(true)
+
+			db := fake.NewFakeDatabase()
+			stats := importRecords(db, []string{recordPath}, journal)
+			So(stats.Saved, ShouldEqual, 0)
+			So(stats.Skipped, ShouldEqual, 3)
+			So(db.RecordList, ShouldBeEmpty)
+		})
+
+		Convey("reuses uploaded assets", func() {
+			journal, err := openImportJournal(journalPath, true)
+			So(err, ShouldBeNil)
+			defer journal.close(true)
+			journal.records = map[string]map[int]bool{}
+
+			newDB := fake.NewFakeDatabase()
+			stats := importRecords(newDB, []string{recordPath}, journal)
+			So(stats.Saved, ShouldEqual, 3)
+			So(newDB.AssetList, ShouldBeEmpty)
+			So(newDB.RecordList["note"]["1"].Data["attachment"], ShouldResemble,
+				db.RecordList["note"]["1"].Data["attachment"])
+		})
+
+		Convey("starts afresh without resume", func() {
+			journal, err := openImportJournal(journalPath, false)
+			So(err, ShouldBeNil)
+			defer journal.close(true)
+
+			So(journal.recordImported(recordPath, 0), ShouldBeFalse)
+			_, ok := journal.assetName(filepath.Join(dir, "asset.txt"))
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestImportJournalFilePath(t *testing.T) {
+	Convey("Import journal path", t, func() {
+		defer func() {
+			importJournalPath = ""
+			importResume = false
+		}()
+
+		Convey("is empty without --journal or --resume", func() {
+			path, err := importJournalFilePath([]string{"note.json"})
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "")
+		})
+
+		Convey("defaults with --resume", func() {
+			importResume = true
+			path, err := importJournalFilePath([]string{"note.json"})
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, defaultImportJournalPath)
+		})
+
+		Convey("is set by --journal", func() {
+			importJournalPath = "note.journal"
+			path, err := importJournalFilePath([]string{"note.json"})
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "note.journal")
+		})
+
+		Convey("is refused for stdin", func() {
+			importResume = true
+			_, err := importJournalFilePath(nil)
+			So(err, ShouldNotBeNil)
+
+			importResume = false
+			importJournalPath = "note.journal"
+			_, err = importJournalFilePath(nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestFetchRecords(t *testing.T) {
+	Convey("Fetch records in a request", t, func() {
+		var payload map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&payload)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": []interface{}{
+					map[string]interface{}{"_id": "note/1", "_type": "record", "title": "hello"},
+					map[string]interface{}{
+						"_id":     "note/2",
+						"_type":   "error",
+						"name":    "ResourceNotFound",
+						"code":    110,
+						"message": "record not found",
+					},
+				},
+			})
+		}))
+		defer server.Close()
+
+		c := &skycontainer.Container{Endpoint: server.URL + "/"}
+		db := &skycontainer.Database{Container: c, DatabaseID: "_public"}
+
+		recordList, errs, err := db.FetchRecords([]string{"note/1", "note/2"})
+		So(err, ShouldBeNil)
+		So(payload["ids"], ShouldResemble, []interface{}{"note/1", "note/2"})
+		So(recordList, ShouldHaveLength, 2)
+		So(recordList[0].Data["title"], ShouldEqual, "hello")
+		So(recordList[1], ShouldBeNil)
+		So(errs[0], ShouldBeNil)
+		So(isNotFound(errs[1]), ShouldBeTrue)
+	})
+}
+
+func TestSaveRecords(t *testing.T) {
+	Convey("Save records in a request", t, func() {
+		var payload map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&payload)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": []interface{}{
+					map[string]interface{}{"_id": "note/1", "_type": "record"},
+					map[string]interface{}{
+						"_id":     "note/2",
+						"_type":   "error",
+						"name":    "PermissionDenied",
+						"code":    102,
+						"message": "no permission",
+					},
+				},
+			})
+		}))
+		defer server.Close()
+
+		c := &skycontainer.Container{Endpoint: server.URL + "/"}
+		db := &skycontainer.Database{Container: c, DatabaseID: "_public"}
+
+		note1, _ := skyrecord.MakeEmptyRecord("note/1")
+		note2, _ := skyrecord.MakeEmptyRecord("note/2")
+		errs, err := db.SaveRecords([]*skyrecord.Record{note1, note2})
+		So(err, ShouldBeNil)
+		So(payload["records"], ShouldHaveLength, 2)
+		So(errs, ShouldHaveLength, 2)
+		So(errs[0], ShouldBeNil)
+		So(errs[1], ShouldResemble, &skycontainer.SkygearError{
+			ID:      "note/2",
+			Name:    "PermissionDenied",
+			Code:    skycontainer.PermissionDenied,
+			Message: "no permission",
+		})
+	})
+}
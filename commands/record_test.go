@@ -15,10 +15,14 @@
 package commands
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"regexp"
 	"testing"
 
+	skycontainer "github.com/skygeario/skycli/container"
 	fake "github.com/skygeario/skycli/container/fakecontainer"
 	skyrecord "github.com/skygeario/skycli/record"
 	. "github.com/smartystreets/goconvey/convey"
@@ -192,6 +196,353 @@ func TestSaveRecord(t *testing.T) {
 	})
 }
 
+// fetchCountingDatabase counts the requests fetching records
+type fetchCountingDatabase struct {
+	*fake.FakeDatabase
+	fetches int
+}
+
+func (d *fetchCountingDatabase) FetchRecord(recordID string) (*skyrecord.Record, error) {
+	d.fetches++
+	return d.FakeDatabase.FetchRecord(recordID)
+}
+
+func (d *fetchCountingDatabase) FetchRecords(recordIDList []string) ([]*skyrecord.Record, []error, error) {
+	d.fetches++
+	return d.FakeDatabase.FetchRecords(recordIDList)
+}
+
+func TestRemoveMissingKeys(t *testing.T) {
+	Convey("Remove missing keys", t, func() {
+		db := fake.NewFakeDatabase()
+		current, _ := skyrecord.MakeRecord(map[string]interface{}{
+			"_id": "test/1234", "field1": "str1", "field2": 2,
+		})
+		So(db.SaveRecord(current), ShouldBeNil)
+
+		Convey("of existing record", func() {
+			record, _ := skyrecord.MakeRecord(map[string]interface{}{
+				"_id": "test/1234", "field1": "str2",
+			})
+			So(removeMissingKeys(db, record), ShouldBeNil)
+			So(record.Data, ShouldResemble, map[string]interface{}{
+				"field1": "str2",
+				"field2": nil,
+			})
+		})
+
+		Convey("of new record", func() {
+			record, _ := skyrecord.MakeRecord(map[string]interface{}{
+				"_id": "test/5678", "field1": "str2",
+			})
+			So(removeMissingKeys(db, record), ShouldBeNil)
+			So(record.Data, ShouldResemble, map[string]interface{}{
+				"field1": "str2",
+			})
+		})
+
+		Convey("of batch in a single request", func() {
+			saveMode = saveModeReplace
+			defer func() {
+				saveMode = saveModeMerge
+			}()
+
+			existing, _ := skyrecord.MakeRecord(map[string]interface{}{
+				"_id": "test/5678", "field3": true,
+			})
+			So(db.SaveRecord(existing), ShouldBeNil)
+
+			countingDB := &fetchCountingDatabase{FakeDatabase: db}
+			var batch []importItem
+			for _, recordID := range []string{"test/1234", "test/5678", "test/new"} {
+				record, _ := skyrecord.MakeRecord(map[string]interface{}{
+					"_id": recordID, "field1": "str2",
+				})
+				batch = append(batch, importItem{record: record})
+			}
+
+			im := &recordImporter{requests: make(chan struct{}, 1)}
+			errs := im.prepareBatch(countingDB, batch)
+			So(errs, ShouldResemble, []error{nil, nil, nil})
+			So(countingDB.fetches, ShouldEqual, 1)
+			So(batch[0].record.Data, ShouldResemble, map[string]interface{}{
+				"field1": "str2", "field2": nil,
+			})
+			So(batch[1].record.Data, ShouldResemble, map[string]interface{}{
+				"field1": "str2", "field3": nil,
+			})
+			So(batch[2].record.Data, ShouldResemble, map[string]interface{}{
+				"field1": "str2",
+			})
+		})
+
+		Convey("keeps assets skipped", func() {
+			saveMode = saveModeReplace
+			skipAsset = true
+			defer func() {
+				saveMode = saveModeMerge
+				skipAsset = false
+			}()
+
+			record, _ := skyrecord.MakeRecord(map[string]interface{}{
+				"_id": "test/1234", "field1": "@file:photo.jpg", "field2": 3,
+			})
+			So(saveRecord(db, record, ""), ShouldBeNil)
+			So(db.RecordList["test"]["1234"].Data, ShouldNotContainKey, "field1")
+
+			record, _ = skyrecord.MakeRecord(map[string]interface{}{
+				"_id": "test/1234", "field1": "@file:photo.jpg",
+			})
+			im := &recordImporter{requests: make(chan struct{}, 1)}
+			errs := im.prepareBatch(db, []importItem{{record: record}})
+			So(errs, ShouldResemble, []error{nil})
+			So(record.Data, ShouldResemble, map[string]interface{}{"field2": nil})
+		})
+	})
+}
+
+func TestUpdateRecords(t *testing.T) {
+	Convey("Update records", t, func() {
+		db := fake.NewFakeDatabase()
+		for i := 0; i < 3; i++ {
+			record, _ := skyrecord.MakeRecord(map[string]interface{}{
+				"_id":   fmt.Sprintf("note/%d", i),
+				"index": i,
+			})
+			So(db.SaveRecord(record), ShouldBeNil)
+		}
+		defer func() {
+			queryWhere = nil
+			assignEmptyAsNull = false
+		}()
+
+		Convey("with record ID", func() {
+			count, err := updateRecords(db, "note/1", nil, func(record *skyrecord.Record) error {
+				return assignAttributes(record, []string{"title=hello", "body="}, nil)
+			})
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+			So(db.RecordList["note"]["1"].Data["title"], ShouldEqual, "hello")
+			So(db.RecordList["note"]["1"].Data["body"], ShouldEqual, "")
+		})
+
+		Convey("with null assignment", func() {
+			assignEmptyAsNull = true
+			count, err := updateRecords(db, "note/1", nil, func(record *skyrecord.Record) error {
+				return assignAttributes(record, []string{"body=", "title=a=b"}, nil)
+			})
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+			data := db.RecordList["note"]["1"].Data
+			body, ok := data["body"]
+			So(ok, ShouldBeTrue)
+			So(body, ShouldBeNil)
+			So(data["title"], ShouldEqual, "a=b")
+		})
+
+		Convey("unset with conditions", func() {
+			queryWhere = stringListFlag{"index>0"}
+			count, err := updateRecords(db, "note", nil, func(record *skyrecord.Record) error {
+				return unsetAttributes(record, []string{"index"})
+			})
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+			So(db.RecordList["note"]["0"].Data["index"], ShouldEqual, 0)
+			So(db.RecordList["note"]["1"].Data["index"], ShouldBeNil)
+			So(db.RecordList["note"]["2"].Data["index"], ShouldBeNil)
+		})
+
+		Convey("of record type without conditions", func() {
+			_, err := updateRecords(db, "note", nil, func(record *skyrecord.Record) error {
+				return unsetAttributes(record, []string{"index"})
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("with reserved key", func() {
+			_, err := updateRecords(db, "note/1", nil, func(record *skyrecord.Record) error {
+				return unsetAttributes(record, []string{"_id"})
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestAssignAttributes(t *testing.T) {
+	Convey("Assign attributes", t, func() {
+		record, _ := skyrecord.MakeEmptyRecord("user/1")
+
+		Convey("with typed values", func() {
+			err := assignAttributes(record, []string{
+				"age:=10",
+				"active:=true",
+				`tags:=["a","b"]`,
+				`meta:={"x":1}`,
+				"removed:=null",
+				"name=10",
+			}, nil)
+			So(err, ShouldBeNil)
+			So(record.Data, ShouldResemble, map[string]interface{}{
+				"age":     float64(10),
+				"active":  true,
+				"tags":    []interface{}{"a", "b"},
+				"meta":    map[string]interface{}{"x": float64(1)},
+				"removed": nil,
+				"name":    "10",
+			})
+		})
+
+		Convey("with invalid typed value", func() {
+			So(assignAttributes(record, []string{"age:=ten"}, nil), ShouldNotBeNil)
+			So(assignAttributes(record, []string{"age:="}, nil), ShouldNotBeNil)
+		})
+
+		Convey("with schema types", func() {
+			types := map[string]string{
+				"age":     "number",
+				"count":   "integer",
+				"active":  "boolean",
+				"meta":    "json",
+				"name":    "string",
+				"created": "datetime",
+			}
+			err := assignAttributes(record, []string{
+				"age=10.5",
+				"count=3",
+				"active=true",
+				`meta={"x":1}`,
+				"name=10",
+				"created=@date:2016-01-01",
+				"other=true",
+				"typed:=1",
+			}, types)
+			So(err, ShouldBeNil)
+			So(record.Data, ShouldResemble, map[string]interface{}{
+				"age":     10.5,
+				"count":   int64(3),
+				"active":  true,
+				"meta":    map[string]interface{}{"x": float64(1)},
+				"name":    "10",
+				"created": "@date:2016-01-01",
+				"other":   "true",
+				"typed":   float64(1),
+			})
+
+			So(assignAttributes(record, []string{"age=ten"}, types), ShouldNotBeNil)
+
+			So(assignAttributes(record, []string{"created=2016-01-01T00:00:00Z"}, types), ShouldBeNil)
+			So(record.Data["created"], ShouldResemble, map[string]interface{}{
+				"$type": "date",
+				"$date": "2016-01-01T00:00:00Z",
+			})
+		})
+
+		Convey("with empty values as null and schema types", func() {
+			assignEmptyAsNull = true
+			defer func() {
+				assignEmptyAsNull = false
+			}()
+
+			types := map[string]string{"age": "number", "name": "string"}
+			err := assignAttributes(record, []string{"age=", "name=", "count="}, types)
+			So(err, ShouldBeNil)
+			So(record.Data, ShouldResemble, map[string]interface{}{
+				"age":   nil,
+				"name":  nil,
+				"count": nil,
+			})
+		})
+	})
+}
+
+func TestNestedPaths(t *testing.T) {
+	Convey("Nested paths", t, func() {
+		db := fake.NewFakeDatabase()
+		record, _ := skyrecord.MakeRecord(map[string]interface{}{
+			"_id": "note/1",
+			"meta": map[string]interface{}{
+				"address": map[string]interface{}{"city": "Hong Kong"},
+				"title":   "hello",
+			},
+			"tags": []interface{}{"a", "b"},
+		})
+		So(db.SaveRecord(record), ShouldBeNil)
+
+		update := func(paths []string, update func(*skyrecord.Record) error) error {
+			_, err := updateRecords(db, "note/1", paths, update)
+			return err
+		}
+		set := func(exprs ...string) error {
+			return update(exprs, func(record *skyrecord.Record) error {
+				return assignAttributes(record, exprs, nil)
+			})
+		}
+
+		Convey("get nested values", func() {
+			value, err := record.GetPath("meta.address.city")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "Hong Kong")
+
+			value, err = record.GetPath("tags[1]")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "b")
+
+			value, err = record.GetPath("meta.missing.key")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "")
+
+			_, err = record.GetPath("meta.title.length")
+			So(err, ShouldResemble, fmt.Errorf("meta.title is not an object."))
+			_, err = record.GetPath("meta[0]")
+			So(err, ShouldResemble, fmt.Errorf("meta is not an array."))
+			_, err = record.GetPath("tags[")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("set nested values keeping the other values", func() {
+			// Paths are set by the keys of the assignments
+			err := update([]string{"meta.address.city", "tags[2]"}, func(record *skyrecord.Record) error {
+				return assignAttributes(record, []string{"meta.address.city=Tokyo", "tags[2]=c"}, nil)
+			})
+			So(err, ShouldBeNil)
+
+			data := db.RecordList["note"]["1"].Data
+			So(data["meta"], ShouldResemble, map[string]interface{}{
+				"address": map[string]interface{}{"city": "Tokyo"},
+				"title":   "hello",
+			})
+			So(data["tags"], ShouldResemble, []interface{}{"a", "b", "c"})
+		})
+
+		Convey("set values in missing objects", func() {
+			So(set("meta.stats.count:=1"), ShouldBeNil)
+			So(db.RecordList["note"]["1"].Data["meta"], ShouldResemble, map[string]interface{}{
+				"address": map[string]interface{}{"city": "Hong Kong"},
+				"title":   "hello",
+				"stats":   map[string]interface{}{"count": float64(1)},
+			})
+		})
+
+		Convey("report invalid intermediate values", func() {
+			So(set("meta.title.length:=5"), ShouldResemble, fmt.Errorf("meta.title is not an object."))
+			So(set("tags.first=a"), ShouldResemble, fmt.Errorf("tags is not an object."))
+			So(set("tags[5]=f"), ShouldResemble, fmt.Errorf("tags[5] is out of range of 2 elements."))
+		})
+
+		Convey("unset nested values", func() {
+			paths := []string{"meta.address", "tags[0]"}
+			err := update(paths, func(record *skyrecord.Record) error {
+				return unsetAttributes(record, paths)
+			})
+			So(err, ShouldBeNil)
+
+			data := db.RecordList["note"]["1"].Data
+			So(data["meta"], ShouldResemble, map[string]interface{}{"title": "hello"})
+			So(data["tags"], ShouldResemble, []interface{}{"b"})
+		})
+	})
+}
+
 func TestFetchRecord(t *testing.T) {
 	Convey("Normal Record", t, func() {
 		db := fake.NewFakeDatabase()
@@ -253,7 +604,7 @@ func TestQueryRecord(t *testing.T) {
 		err = saveRecord(db, record2, "")
 		So(err, ShouldBeNil)
 
-		output, err := queryRecord(db, "test")
+		output, err := queryRecord(db, skycontainer.NewQuery("test"))
 		So(err, ShouldBeNil)
 		So(len(output), ShouldEqual, 2)
 
@@ -272,7 +623,91 @@ func TestQueryRecord(t *testing.T) {
 	Convey("Record type not exist", t, func() {
 		db := fake.NewFakeDatabase()
 
-		_, err := queryRecord(db, "notexist")
+		_, err := queryRecord(db, skycontainer.NewQuery("notexist"))
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestPrintAllQueryRecord(t *testing.T) {
+	Convey("Print all records of query", t, func() {
+		f, err := ioutil.TempFile("", "skycli")
 		So(err, ShouldBeNil)
+		f.Close()
+		defer os.Remove(f.Name())
+		recordOutputPath = f.Name()
+		defer func() {
+			recordOutputPath = ""
+		}()
+
+		db := &sortRecordingDatabase{FakeDatabase: fake.NewFakeDatabase()}
+		for _, id := range []string{"test/3", "test/1", "test/2"} {
+			record, _ := skyrecord.MakeRecord(map[string]interface{}{"_id": id, "group": 1})
+			So(saveRecord(db, record, ""), ShouldBeNil)
+		}
+
+		queryPageSize = 2
+		defer func() {
+			queryPageSize = skycontainer.DefaultPageSize
+		}()
+		query := skycontainer.NewQuery("test").AddDescending("group")
+		So(printAllQueryRecord(db, query), ShouldBeNil)
+
+		So(db.sorts, ShouldHaveLength, 2)
+		So(db.sorts[0], ShouldResemble, []skycontainer.Sort{
+			{Key: "group", Order: skycontainer.Descending},
+			{Key: "_id", Order: skycontainer.Ascending},
+		})
+
+		output, err := ioutil.ReadFile(f.Name())
+		So(err, ShouldBeNil)
+		So(regexp.MustCompile(`"_id":"(test/\d)"`).FindAllStringSubmatch(string(output), -1), ShouldHaveLength, 3)
+	})
+}
+
+func TestIncludeRecord(t *testing.T) {
+	Convey("Include referenced records", t, func() {
+		db := fake.NewFakeDatabase()
+
+		teacher, _ := skyrecord.MakeRecord(map[string]interface{}{"_id": "teacher/1", "name": "Bob"})
+		So(saveRecord(db, teacher, ""), ShouldBeNil)
+		student, _ := skyrecord.MakeRecord(map[string]interface{}{
+			"_id":     "student/1",
+			"name":    "Alice",
+			"teacher": map[string]interface{}{"$type": "ref", "$id": "teacher/1"},
+		})
+		So(saveRecord(db, student, ""), ShouldBeNil)
+
+		expectedTeacher := map[string]interface{}{"_id": "teacher/1", "name": "Bob"}
+
+		recordInclude = "teacher"
+		defer func() {
+			recordInclude = ""
+			includeAsTransient = false
+		}()
+
+		Convey("inlines referenced record when fetching", func() {
+			output, err := fetchRecord(db, "student/1")
+			So(err, ShouldBeNil)
+			So(output.Data, ShouldResemble, map[string]interface{}{
+				"name":    "Alice",
+				"teacher": expectedTeacher,
+			})
+		})
+
+		Convey("writes referenced record into _transient when querying", func() {
+			includeAsTransient = true
+			query := skycontainer.NewQuery("student").Include("teacher")
+
+			output, err := queryRecord(db, query)
+			So(err, ShouldBeNil)
+			So(len(output), ShouldEqual, 1)
+			So(output[0].Data["teacher"], ShouldResemble, map[string]interface{}{"$type": "ref", "$id": "teacher/1"})
+			So(output[0].Data["_transient"], ShouldResemble, map[string]interface{}{"teacher": expectedTeacher})
+		})
+
+		Convey("fails when fetching record not exist", func() {
+			_, err := fetchRecord(db, "student/2")
+			So(err, ShouldNotBeNil)
+		})
 	})
 }
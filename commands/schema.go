@@ -41,7 +41,7 @@ var schemaAddCmd = &cobra.Command{
 		checkMinArgCount(cmd, args, 3)
 		checkMaxArgCount(cmd, args, 3)
 
-		db := newDatabase()
+		db := newDatabaseForWrite()
 		err := db.CreateColumn(args[0], args[1], args[2])
 		if err != nil {
 			fatal(err)
@@ -57,7 +57,7 @@ var schemaMoveCmd = &cobra.Command{
 		checkMinArgCount(cmd, args, 3)
 		checkMaxArgCount(cmd, args, 3)
 
-		db := newDatabase()
+		db := newDatabaseForWrite()
 		err := db.RenameColumn(args[0], args[1], args[2])
 		if err != nil {
 			fatal(err)
@@ -73,7 +73,7 @@ var schemaRemoveCmd = &cobra.Command{
 		checkMinArgCount(cmd, args, 2)
 		checkMaxArgCount(cmd, args, 2)
 
-		db := newDatabase()
+		db := newDatabaseForWrite()
 		err := db.DeleteColumn(args[0], args[1])
 		if err != nil {
 			fatal(err)
@@ -15,8 +15,12 @@
 package commands
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/skygeario/skycli/container"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -24,24 +28,53 @@ var SkygearCliCmd = &cobra.Command{
 	Use:   "skycli",
 	Short: "Command line interface to Skygear",
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if errorFormat != "text" && errorFormat != "json" {
+			fatal(fmt.Errorf("Unknown error format %s.", errorFormat))
+		}
 		LoadConfigFile()
 	},
 }
 
 var skygearAPIKey string
 var skygearEndpoint string
+var skygearMasterKey string
 var skygearAccessToken string
+var skygearProfile string
+var skygearAsUser string
+var skygearRetries int
+var skygearTimeout time.Duration
+
+// globalFlags are the flags available to all commands
+var globalFlags *pflag.FlagSet
 
 func init() {
-	SkygearCliCmd.PersistentFlags().String("config", "", "Config file location. Default is $HOME/.skycli/config.toml")
+	globalFlags = SkygearCliCmd.PersistentFlags()
+	SkygearCliCmd.PersistentFlags().String("config", "", "Config file location. Default is ./.skycli/config or $HOME/.skycli/config.toml")
 	SkygearCliCmd.PersistentFlags().StringVar(&skygearAPIKey, "api_key", "", "API Key")
+	SkygearCliCmd.PersistentFlags().StringVar(&skygearMasterKey, "master_key", "", "Master key, which is used in place of API key")
 	SkygearCliCmd.PersistentFlags().StringVar(&skygearEndpoint, "endpoint", "", "Endpoint address (e.g. https://your-endpoint.skygeario.com/)")
 	SkygearCliCmd.PersistentFlags().StringVar(&skygearAccessToken, "access_token", "", "Access token")
+	SkygearCliCmd.PersistentFlags().StringVar(&skygearProfile, "profile", "", "Name of the profile in config file to use")
+	SkygearCliCmd.PersistentFlags().StringVar(&skygearAsUser, "as_user", "", "ID of the user to act as. Requires master key.")
+	SkygearCliCmd.PersistentFlags().IntVar(&skygearRetries, "retries", 3, "Number of times to retry a failed request")
+	SkygearCliCmd.PersistentFlags().DurationVar(&skygearTimeout, "timeout", 2*time.Minute, "Time limit of each request except asset uploads and downloads (e.g. 30s). No limit if it is 0.")
+
+	SkygearCliCmd.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "Log requests to stderr. Repeat to log more details (e.g. -vv).")
+	SkygearCliCmd.PersistentFlags().BoolVar(&traceHTTP, "trace-http", false, "Log requests to stderr with headers and bodies")
+	SkygearCliCmd.PersistentFlags().StringVar(&harOutputPath, "har", "", "Save requests to a HAR file")
+	SkygearCliCmd.PersistentFlags().StringVar(&dateTimezone, "timezone", "", "Time zone of @date: values without an offset (e.g. UTC or Asia/Hong_Kong). Default is the local time zone.")
+	SkygearCliCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the requests that would modify data instead of sending them")
+	SkygearCliCmd.PersistentFlags().StringVar(&errorFormat, "error-format", "text", "Format of errors and warnings printed to stderr (text or json)")
 
 	viper.BindPFlag("access_token", SkygearCliCmd.PersistentFlags().Lookup("access_token"))
 	viper.BindPFlag("endpoint", SkygearCliCmd.PersistentFlags().Lookup("endpoint"))
 	viper.BindPFlag("api_key", SkygearCliCmd.PersistentFlags().Lookup("api_key"))
+	viper.BindPFlag("master_key", SkygearCliCmd.PersistentFlags().Lookup("master_key"))
 	viper.BindPFlag("config", SkygearCliCmd.PersistentFlags().Lookup("config"))
+	viper.BindPFlag("retries", SkygearCliCmd.PersistentFlags().Lookup("retries"))
+	viper.BindPFlag("timeout", SkygearCliCmd.PersistentFlags().Lookup("timeout"))
+	viper.BindPFlag("current_profile", SkygearCliCmd.PersistentFlags().Lookup("profile"))
+	viper.BindEnv("current_profile", "SKYCLI_PROFILE")
 
 }
 
@@ -56,14 +89,36 @@ func Execute() {
 func AddCommands() {
 	SkygearCliCmd.AddCommand(recordCmd)
 	SkygearCliCmd.AddCommand(schemaCmd)
+	SkygearCliCmd.AddCommand(backupCmd)
+	SkygearCliCmd.AddCommand(restoreCmd)
+	SkygearCliCmd.AddCommand(copyCmd)
+	SkygearCliCmd.AddCommand(configCmd)
+	SkygearCliCmd.AddCommand(authCmd)
 	SkygearCliCmd.AddCommand(generateDocCmd)
 	SkygearCliCmd.AddCommand(versionCmd)
 }
 
 func newContainer() *container.Container {
+	return newContainerWithConfig(Config)
+}
+
+func newContainerWithConfig(cfg config) *container.Container {
+	if skygearAsUser != "" && cfg.MasterKey == "" {
+		fatal(fmt.Errorf("Acting as a user requires master key."))
+	}
+
+	retryPolicy := container.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = viper.GetInt("retries") + 1
+
 	return &container.Container{
-		APIKey:      Config.APIKey,
-		Endpoint:    Config.Endpoint,
-		AccessToken: Config.AccessToken,
+		APIKey:      cfg.APIKey,
+		MasterKey:   cfg.MasterKey,
+		Endpoint:    cfg.Endpoint,
+		AccessToken: cfg.AccessToken,
+		UserID:      skygearAsUser,
+		Timeout:     viper.GetDuration("timeout"),
+		RetryPolicy: retryPolicy,
+		Tracer:      newRequestTracer(),
+		DryRun:      newDryRunner(),
 	}
 }
@@ -0,0 +1,317 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	skycontainer "github.com/skygeario/skycli/container"
+)
+
+// Verbosity levels of tracing requests
+const (
+	traceSummary = 1
+	traceHeaders = 2
+	traceBodies  = 3
+)
+
+var verbosity int
+var traceHTTP bool
+var harOutputPath string
+
+// httpTracer logs requests according to the verbosity, and records them
+// to a HAR file if harPath is not empty
+type httpTracer struct {
+	w       io.Writer
+	level   int
+	harPath string
+
+	mutex   sync.Mutex
+	harFile *os.File
+	// harEnd is the offset of the end of the last entry in the HAR file,
+	// which is followed by the end of the log
+	harEnd     int64
+	harEntries int
+}
+
+var requestTracer *httpTracer
+var requestTracerOnce sync.Once
+
+// newRequestTracer returns the tracer shared by all containers, or nil if
+// requests are not traced
+func newRequestTracer() skycontainer.RequestTracer {
+	requestTracerOnce.Do(func() {
+		level := verbosity
+		if traceHTTP {
+			level = traceBodies
+		}
+		if level == 0 && harOutputPath == "" {
+			return
+		}
+
+		requestTracer = &httpTracer{
+			w:       os.Stderr,
+			level:   level,
+			harPath: harOutputPath,
+		}
+	})
+
+	// Avoid returning an interface holding a nil pointer
+	if requestTracer == nil {
+		return nil
+	}
+	return requestTracer
+}
+
+func (t *httpTracer) TraceRequest(trace *skycontainer.RequestTrace) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.logRequest(trace)
+	if t.harPath != "" {
+		err := t.writeHAREntry(makeHAREntry(trace))
+		if err != nil {
+			warn(fmt.Errorf("Unable to write HAR file: %s", err))
+			// Stop writing to avoid a warning for every request
+			t.harPath = ""
+		}
+	}
+}
+
+func (t *httpTracer) logHeader(prefix string, header http.Header) {
+	var names []string
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(t.w, "%s %s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+func (t *httpTracer) logRequest(trace *skycontainer.RequestTrace) {
+	if t.level < traceSummary {
+		return
+	}
+
+	fmt.Fprintf(t.w, "> %s %s", trace.Method, trace.URL)
+	if trace.Action != "" {
+		fmt.Fprintf(t.w, " (%s)", trace.Action)
+	}
+	if trace.Attempt > 1 {
+		fmt.Fprintf(t.w, " attempt %d", trace.Attempt)
+	}
+	fmt.Fprintln(t.w)
+	if t.level >= traceHeaders {
+		t.logHeader(">", trace.RequestHeader)
+	}
+	if t.level >= traceBodies && len(trace.RequestBody) > 0 {
+		fmt.Fprintf(t.w, "> %s\n", trace.RequestBody)
+	}
+
+	duration := trace.Duration / time.Millisecond * time.Millisecond
+	if trace.Err != nil {
+		fmt.Fprintf(t.w, "< %s (%s)\n", trace.Err, duration)
+		return
+	}
+	fmt.Fprintf(t.w, "< %d %s (%s)\n", trace.StatusCode, http.StatusText(trace.StatusCode), duration)
+	if t.level >= traceHeaders {
+		t.logHeader("<", trace.ResponseHeader)
+	}
+	if t.level >= traceBodies && len(trace.ResponseBody) > 0 {
+		fmt.Fprintf(t.w, "< %s\n", trace.ResponseBody)
+	}
+}
+
+// harNameValue is a header in HAR format
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harTimings struct {
+	Send    int64 `json:"send"`
+	Wait    int64 `json:"wait"`
+	Receive int64 `json:"receive"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            int64       `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			headers = append(headers, harNameValue{name, value})
+		}
+	}
+	return headers
+}
+
+func makeHAREntry(trace *skycontainer.RequestTrace) harEntry {
+	milliseconds := int64(trace.Duration / time.Millisecond)
+	entry := harEntry{
+		StartedDateTime: trace.StartedAt.Format(time.RFC3339Nano),
+		Time:            milliseconds,
+		Request: harRequest{
+			Method:      trace.Method,
+			URL:         trace.URL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(trace.RequestHeader),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(trace.RequestBody),
+		},
+		Response: harResponse{
+			Status:      trace.StatusCode,
+			StatusText:  http.StatusText(trace.StatusCode),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(trace.ResponseHeader),
+			Content: harContent{
+				Size:     len(trace.ResponseBody),
+				MimeType: trace.ResponseHeader.Get("Content-Type"),
+				Text:     string(trace.ResponseBody),
+			},
+			HeadersSize: -1,
+			BodySize:    len(trace.ResponseBody),
+		},
+		Timings: harTimings{Wait: milliseconds},
+		Comment: trace.Action,
+	}
+	if trace.RequestBody != nil {
+		entry.Request.PostData = &harPostData{
+			MimeType: "application/json",
+			Text:     string(trace.RequestBody),
+		}
+	}
+	if trace.Err != nil {
+		entry.Response.StatusText = trace.Err.Error()
+	}
+	return entry
+}
+
+// harLogEnd ends the entries and the log of a HAR file
+const harLogEnd = "\n  ]\n}}\n"
+
+// createHAR creates the HAR file with no entries
+func (t *httpTracer) createHAR() error {
+	creator, err := json.Marshal(map[string]interface{}{
+		"name":    "skycli",
+		"version": version,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(t.harPath)
+	if err != nil {
+		return err
+	}
+	start := fmt.Sprintf("{\"log\": {\n  \"version\": \"1.2\",\n  \"creator\": %s,\n  \"entries\": [", creator)
+	_, err = f.WriteString(start + harLogEnd)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	t.harFile = f
+	t.harEnd = int64(len(start))
+	return nil
+}
+
+// writeHAREntry appends the entry to the HAR file. Each entry is written
+// over the end of the log, which is written again after it, so that the
+// file is complete even if skycli exits early, without keeping the
+// entries in memory.
+func (t *httpTracer) writeHAREntry(entry harEntry) error {
+	if t.harFile == nil {
+		err := t.createHAR()
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(entry, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	separator := "\n    "
+	if t.harEntries > 0 {
+		separator = "," + separator
+	}
+	data = append([]byte(separator), data...)
+
+	_, err = t.harFile.WriteAt(append(data, harLogEnd...), t.harEnd)
+	if err != nil {
+		return err
+	}
+	t.harEnd += int64(len(data))
+	t.harEntries++
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHTTPTracer(t *testing.T) {
+	Convey("HTTP tracer", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": map[string]interface{}{
+					"user_id":      "alice-id",
+					"access_token": "alice-token",
+				},
+			})
+		}))
+		defer server.Close()
+
+		var out bytes.Buffer
+		tracer := &httpTracer{w: &out}
+		c := &skycontainer.Container{
+			Endpoint:    server.URL + "/",
+			APIKey:      "secret-api-key",
+			AccessToken: "secret-token",
+			Tracer:      tracer,
+		}
+
+		Convey("logs summary", func() {
+			tracer.level = traceSummary
+			_, err := c.WhoAmI()
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldStartWith, "> POST "+server.URL+"/me (me)\n< 200 OK (")
+			So(out.String(), ShouldNotContainSubstring, "X-Skygear")
+		})
+
+		Convey("logs headers and bodies with secrets redacted", func() {
+			tracer.level = traceBodies
+			_, err := c.WhoAmI()
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, "> X-Skygear-Api-Key: REDACTED\n")
+			So(out.String(), ShouldContainSubstring, "> X-Skygear-Access-Token: REDACTED\n")
+			So(out.String(), ShouldContainSubstring, `"action":"me"`)
+			So(out.String(), ShouldContainSubstring, `"user_id":"alice-id"`)
+			So(out.String(), ShouldNotContainSubstring, "secret")
+			So(out.String(), ShouldNotContainSubstring, "alice-token")
+		})
+
+		Convey("writes HAR file", func() {
+			dir, err := ioutil.TempDir("", "skycli")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			tracer.harPath = filepath.Join(dir, "trace.har")
+			defer func() {
+				tracer.harFile.Close()
+			}()
+
+			var har struct {
+				Log struct {
+					Version string     `json:"version"`
+					Entries []harEntry `json:"entries"`
+				} `json:"log"`
+			}
+
+			_, err = c.WhoAmI()
+			So(err, ShouldBeNil)
+			So(readJSONFile(tracer.harPath, &har), ShouldBeNil)
+			So(har.Log.Entries, ShouldHaveLength, 1)
+
+			_, err = c.WhoAmI()
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldEqual, "")
+
+			So(readJSONFile(tracer.harPath, &har), ShouldBeNil)
+			So(har.Log.Version, ShouldEqual, "1.2")
+			So(har.Log.Entries, ShouldHaveLength, 2)
+			So(har.Log.Entries[0].Request.Method, ShouldEqual, "POST")
+			So(har.Log.Entries[0].Response.Status, ShouldEqual, 200)
+			So(har.Log.Entries[0].Response.Content.Text, ShouldNotContainSubstring, "alice-token")
+		})
+	})
+}
@@ -38,12 +38,14 @@ func checkMaxArgCount(cmd *cobra.Command, args []string, max int) {
 }
 
 func fatal(err error) {
-	fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-	os.Exit(1)
+	exitIfInterrupted()
+	fmt.Fprintln(os.Stderr, formatError("Error", err))
+	os.Exit(exitCode(err))
 }
 
 func warn(err error) {
-	fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+	exitIfInterrupted()
+	fmt.Fprintln(os.Stderr, formatError("Warning", err))
 }
 
 func printValue(value interface{}) {
@@ -53,7 +55,7 @@ func printValue(value interface{}) {
 		if err != nil {
 			panic(err)
 		}
-		fmt.Println("%s\n", data)
+		fmt.Printf("%s\n", data)
 	case map[string]interface{}:
 		data, err := json.Marshal(value)
 		if err != nil {
@@ -72,10 +74,32 @@ func usingDatabaseID(c *skycontainer.Container) string {
 	return c.PublicDatabaseID()
 }
 
+// warnMasterKeyUsage warns about modifying a production server with
+// master key
+func warnMasterKeyUsage(cfg config) {
+	if cfg.MasterKey != "" && cfg.Production {
+		warn(fmt.Errorf("Modifying production server %s with master key.", cfg.Endpoint))
+	}
+}
+
+// newDatabaseForWrite returns the database for commands that modify it
+//
+// In dry-run mode, changes to the records are printed and the container
+// of the database does not send the mutating requests.
+func newDatabaseForWrite() skycontainer.SkyDB {
+	warnMasterKeyUsage(Config)
+	db := newDatabase()
+	if dryRun {
+		return &dryRunDatabase{db, os.Stdout}
+	}
+	return db
+}
+
 func newDatabase() *skycontainer.Database {
 	c := newContainer()
 	return &skycontainer.Database{
 		Container:  c,
 		DatabaseID: usingDatabaseID(c),
+		Context:    databaseContext(),
 	}
 }
@@ -0,0 +1,128 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"fmt"
+)
+
+// User encapsulates the user data returned by auth actions
+type User struct {
+	UserID      string
+	Username    string
+	Email       string
+	Roles       []string
+	AccessToken string
+}
+
+// makeUser creates a User from the result of an auth action
+func makeUser(data map[string]interface{}) (*User, error) {
+	user := &User{}
+	user.UserID, _ = data["user_id"].(string)
+	if user.UserID == "" {
+		return nil, fmt.Errorf("Unexpected server data.")
+	}
+
+	user.Username, _ = data["username"].(string)
+	user.Email, _ = data["email"].(string)
+	user.AccessToken, _ = data["access_token"].(string)
+	roles, _ := data["roles"].([]interface{})
+	for _, role := range roles {
+		if roleName, ok := role.(string); ok {
+			user.Roles = append(user.Roles, roleName)
+		}
+	}
+	return user, nil
+}
+
+func (c *Container) makeAuthRequest(action string, payload map[string]interface{}) (*User, error) {
+	request := GenericRequest{Payload: payload}
+	response, err := c.MakeRequest(action, &request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.IsError() {
+		return nil, response.Error()
+	}
+
+	resultData, ok := response.Payload["result"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Unexpected server data.")
+	}
+	return makeUser(resultData)
+}
+
+func authPayload(username, email, password string) map[string]interface{} {
+	payload := map[string]interface{}{
+		"password": password,
+	}
+	if username != "" {
+		payload["username"] = username
+	}
+	if email != "" {
+		payload["email"] = email
+	}
+	return payload
+}
+
+// Login logs in with username or email and password. The current access
+// token of the container is not sent, and the access token of the returned
+// user is used for subsequent requests.
+func (c *Container) Login(username, email, password string) (*User, error) {
+	// The current access token may have expired, which gets the request
+	// rejected, and it is replaced anyway
+	c.AccessToken = ""
+	user, err := c.makeAuthRequest("auth:login", authPayload(username, email, password))
+	if err != nil {
+		return nil, err
+	}
+	c.AccessToken = user.AccessToken
+	return user, nil
+}
+
+// Signup creates a user with username or email and password. Like Login,
+// the current access token of the container is not sent, and the access
+// token of the returned user is used for subsequent requests.
+func (c *Container) Signup(username, email, password string) (*User, error) {
+	c.AccessToken = ""
+	user, err := c.makeAuthRequest("auth:signup", authPayload(username, email, password))
+	if err != nil {
+		return nil, err
+	}
+	c.AccessToken = user.AccessToken
+	return user, nil
+}
+
+// Logout invalidates the access token of the container
+func (c *Container) Logout() error {
+	request := GenericRequest{Payload: map[string]interface{}{}}
+	response, err := c.MakeRequest("auth:logout", &request)
+	if err != nil {
+		return err
+	}
+
+	if response.IsError() {
+		return response.Error()
+	}
+
+	c.AccessToken = ""
+	return nil
+}
+
+// WhoAmI returns the user of the access token of the container
+func (c *Container) WhoAmI() (*User, error) {
+	return c.makeAuthRequest("me", map[string]interface{}{})
+}
@@ -24,6 +24,9 @@ import (
 	"time"
 
 	"fmt"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
 )
 
 const actionPartSeparator = ":"
@@ -32,8 +35,34 @@ const requestPartSeparator = "/"
 // Container is a client-side view of remote Skygear functionality
 type Container struct {
 	APIKey      string
+	MasterKey   string
 	Endpoint    string
 	AccessToken string
+
+	// UserID is the ID of the user to act as. It is only effective
+	// with MasterKey.
+	UserID string
+
+	// Client is the HTTP client for sending requests. http.DefaultClient
+	// is used if it is nil.
+	Client *http.Client
+
+	// Timeout is the time limit of each attempt of an action request.
+	// Asset uploads and downloads are not limited, since large assets
+	// take long to transfer. There is no limit if it is 0.
+	Timeout time.Duration
+
+	// RetryPolicy controls how failed requests are retried. Requests are
+	// not retried if it is nil.
+	RetryPolicy *RetryPolicy
+
+	// Tracer receives the traces of the requests if it is not nil
+	Tracer RequestTracer
+
+	// DryRun receives the requests of mutating actions and asset uploads
+	// instead of them being sent if it is not nil. Successful responses
+	// are simulated for these requests.
+	DryRun DryRunner
 }
 
 // actionURL construct the corresponding URL to Skygear
@@ -48,7 +77,9 @@ func (c *Container) createRequest(method, url, contentType string, body io.Reade
 		return nil, err
 	}
 
-	if c.APIKey != "" {
+	if c.MasterKey != "" {
+		req.Header.Set("X-Skygear-API-Key", c.MasterKey)
+	} else if c.APIKey != "" {
 		req.Header.Set("X-Skygear-API-Key", c.APIKey)
 	}
 	if c.AccessToken != "" {
@@ -65,28 +96,125 @@ func (c *Container) fixRequestPayload(action string, payload map[string]interfac
 	if c.AccessToken != "" {
 		payload["access_token"] = c.AccessToken
 	}
+	if c.MasterKey != "" && c.UserID != "" {
+		payload["_user_id"] = c.UserID
+	}
 	if action != "" {
 		payload["action"] = action
 	}
 }
 
-func getBytesResponse(req *http.Request) ([]byte, error) {
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func (c *Container) httpClient() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+func (c *Container) getBytesResponse(ctx context.Context, req *http.Request) (statusCode int, header http.Header, body []byte, err error) {
+	resp, err := ctxhttp.Do(ctx, c.httpClient(), req)
 	if err != nil {
-		return nil, err
+		return
 	}
 	defer resp.Body.Close()
 
-	jsonDataFromHTTP, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	statusCode = resp.StatusCode
+	header = resp.Header
+	body, err = ioutil.ReadAll(resp.Body)
+	return
+}
+
+// getResponseWithTimeout gets the response like getBytesResponse, failing
+// if the response is not read within timeout
+func (c *Container) getResponseWithTimeout(ctx context.Context, req *http.Request, timeout time.Duration) (statusCode int, header http.Header, body []byte, err error) {
+	if timeout <= 0 {
+		return c.getBytesResponse(ctx, req)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	statusCode, header, body, err = c.getBytesResponse(attemptCtx, req)
+	if err != nil && ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("Request timed out after %s.", timeout)
+	}
+	return
+}
+
+// requestInfo describes a request for sending and tracing
+type requestInfo struct {
+	action string
+	// body is the request body to be traced
+	body []byte
+	// idempotent tells whether the request can be sent again safely
+	// after it may have reached the server
+	idempotent bool
+	// binaryResponse tells whether the response body is not to be traced
+	binaryResponse bool
+	// timeout is the time limit of each attempt, or 0 for no limit
+	timeout time.Duration
+}
+
+// sendRequest sends the request created by newRequest, retrying according
+// to the retry policy. A new request is created for each attempt.
+func (c *Container) sendRequest(ctx context.Context, info requestInfo, newRequest func() (*http.Request, error)) (statusCode int, body []byte, err error) {
+	for attempt := 1; ; attempt++ {
+		var req *http.Request
+		req, err = newRequest()
+		if err != nil {
+			return
+		}
+
+		var header http.Header
+		startedAt := time.Now()
+		statusCode, header, body, err = c.getResponseWithTimeout(ctx, req, info.timeout)
+		if c.Tracer != nil {
+			trace := &RequestTrace{
+				Action:        info.action,
+				Attempt:       attempt,
+				Method:        req.Method,
+				URL:           req.URL.String(),
+				RequestHeader: redactHeader(req.Header),
+				RequestBody:   redactBody(info.body),
+
+				StatusCode:     statusCode,
+				ResponseHeader: redactHeader(header),
+				Err:            err,
+
+				StartedAt: startedAt,
+				Duration:  time.Since(startedAt),
+			}
+			if !info.binaryResponse {
+				trace.ResponseBody = redactBody(body)
+			}
+			c.Tracer.TraceRequest(trace)
+		}
+
+		policy := c.RetryPolicy
+		if policy == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !policy.shouldRetry(info.idempotent, statusCode, body, err) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-time.After(policy.backoff(attempt)):
+		}
 	}
-	return jsonDataFromHTTP, nil
+}
+
+func (c *Container) isIdempotentAction(action string) bool {
+	return c.RetryPolicy != nil && c.RetryPolicy.IdempotentActions[action]
 }
 
 // MakeRequest sends request to Skygear
-func (c *Container) MakeRequest(action string, request SkygearRequest) (response *SkygearResponse, err error) {
+func (c *Container) MakeRequest(action string, request SkygearRequest) (*SkygearResponse, error) {
+	return c.MakeRequestContext(context.Background(), action, request)
+}
+
+// MakeRequestContext sends request to Skygear. The request is cancelled
+// when ctx is done.
+func (c *Container) MakeRequestContext(ctx context.Context, action string, request SkygearRequest) (response *SkygearResponse, err error) {
 	url := c.actionURL(action)
 	payload := request.MakePayload()
 	c.fixRequestPayload(action, payload)
@@ -96,12 +224,24 @@ func (c *Container) MakeRequest(action string, request SkygearRequest) (response
 		return nil, err
 	}
 
-	req, err := c.createRequest("POST", url, "", bytes.NewBuffer(jsonStr))
-	if err != nil {
-		return nil, err
+	if c.DryRun != nil && IsMutatingAction(action) {
+		req, err := c.createRequest("POST", url, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		c.dryRun(req.Method, url, action, req.Header, jsonStr)
+		return dryRunResponse(action, jsonStr)
 	}
 
-	jsonDataFromHTTP, err := getBytesResponse(req)
+	info := requestInfo{
+		action:     action,
+		body:       jsonStr,
+		idempotent: c.isIdempotentAction(action),
+		timeout:    c.Timeout,
+	}
+	_, jsonDataFromHTTP, err := c.sendRequest(ctx, info, func() (*http.Request, error) {
+		return c.createRequest("POST", url, "", bytes.NewReader(jsonStr))
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -123,14 +263,43 @@ func (c *Container) assetURL(filename string) string {
 }
 
 // PutAssetRequest sends asset PUT request to Skygear.
-func (c *Container) PutAssetRequest(filename, contentType string, body io.Reader) (response *SkygearResponse, err error) {
+func (c *Container) PutAssetRequest(filename, contentType string, body io.Reader) (*SkygearResponse, error) {
+	return c.PutAssetRequestContext(context.Background(), filename, contentType, body)
+}
+
+// PutAssetRequestContext sends asset PUT request to Skygear. The request
+// is cancelled when ctx is done.
+func (c *Container) PutAssetRequestContext(ctx context.Context, filename, contentType string, body io.Reader) (response *SkygearResponse, err error) {
 	url := c.assetURL(filename)
-	req, err := c.createRequest("PUT", url, contentType, body)
-	if err != nil {
-		return nil, err
+
+	if c.DryRun != nil {
+		req, err := c.createRequest("PUT", url, contentType, nil)
+		if err != nil {
+			return nil, err
+		}
+		c.dryRun(req.Method, url, "", req.Header, nil)
+		return dryRunAssetResponse(filename), nil
+	}
+
+	// The body is read again for each attempt
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		seeker = bytes.NewReader(data)
 	}
 
-	jsonDataFromHTTP, err := getBytesResponse(req)
+	// Asset names are unique, so uploading the same asset again gives
+	// the same result
+	_, jsonDataFromHTTP, err := c.sendRequest(ctx, requestInfo{idempotent: true}, func() (*http.Request, error) {
+		_, err := seeker.Seek(0, 0)
+		if err != nil {
+			return nil, err
+		}
+		return c.createRequest("PUT", url, contentType, ioutil.NopCloser(seeker))
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -145,28 +314,25 @@ func (c *Container) PutAssetRequest(filename, contentType string, body io.Reader
 }
 
 // GetAssetRequest sends GET request to Skygear and get the corresponding asset.
-func (c *Container) GetAssetRequest(assetURL string) (response []byte, err error) {
-	req, err := c.createRequest("GET", assetURL, "", nil)
-	if err != nil {
-		return nil, err
-	}
+func (c *Container) GetAssetRequest(assetURL string) ([]byte, error) {
+	return c.GetAssetRequestContext(context.Background(), assetURL)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// GetAssetRequestContext sends GET request to Skygear and get the
+// corresponding asset. The request is cancelled when ctx is done.
+func (c *Container) GetAssetRequestContext(ctx context.Context, assetURL string) (response []byte, err error) {
+	info := requestInfo{idempotent: true, binaryResponse: true}
+	statusCode, dataFromHTTP, err := c.sendRequest(ctx, info, func() (*http.Request, error) {
+		return c.createRequest("GET", assetURL, "", nil)
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if statusCode != http.StatusOK {
 		return nil, fmt.Errorf("Unexpected status code.")
 	}
 
-	dataFromHTTP, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
 	return dataFromHTTP, nil
 }
 
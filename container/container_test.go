@@ -0,0 +1,156 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/context"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	Convey("Retry policy", t, func() {
+		var attempts int
+		var bodies []string
+		failures := 2
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			if attempts <= failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"error": map[string]interface{}{"code": 10000, "message": "unavailable"},
+				})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": []interface{}{}})
+		}))
+		defer server.Close()
+
+		policy := DefaultRetryPolicy()
+		policy.InitialBackoff = time.Millisecond
+		policy.MaxBackoff = time.Millisecond
+		c := &Container{Endpoint: server.URL + "/", RetryPolicy: policy}
+
+		Convey("retries idempotent action", func() {
+			response, err := c.MakeRequest("record:query", &GenericRequest{Payload: map[string]interface{}{}})
+			So(err, ShouldBeNil)
+			So(response.IsError(), ShouldBeFalse)
+			So(attempts, ShouldEqual, 3)
+		})
+
+		Convey("gives up after max attempts", func() {
+			policy.MaxAttempts = 2
+			response, err := c.MakeRequest("record:query", &GenericRequest{Payload: map[string]interface{}{}})
+			So(err, ShouldBeNil)
+			So(response.IsError(), ShouldBeTrue)
+			So(attempts, ShouldEqual, 2)
+		})
+
+		Convey("does not retry non-idempotent action", func() {
+			response, err := c.MakeRequest("schema:create", &GenericRequest{Payload: map[string]interface{}{}})
+			So(err, ShouldBeNil)
+			So(response.IsError(), ShouldBeTrue)
+			So(attempts, ShouldEqual, 1)
+		})
+
+		Convey("does not retry deleting records", func() {
+			db := &Database{Container: c, DatabaseID: "_public"}
+			err := db.DeleteRecord([]string{"note/1"})
+			So(err, ShouldNotBeNil)
+			So(attempts, ShouldEqual, 1)
+		})
+
+		Convey("retries on Skygear error code", func() {
+			policy.RetryStatusCodes = nil
+			policy.RetryErrorCodes = []int{10000}
+			_, err := c.MakeRequest("record:fetch", &GenericRequest{Payload: map[string]interface{}{}})
+			So(err, ShouldBeNil)
+			So(attempts, ShouldEqual, 3)
+		})
+
+		Convey("sends asset again", func() {
+			_, err := c.PutAssetRequest("asset.txt", "text/plain", strings.NewReader("content"))
+			So(err, ShouldBeNil)
+			So(bodies, ShouldResemble, []string{"content", "content", "content"})
+		})
+
+		Convey("does not retry without policy", func() {
+			c.RetryPolicy = nil
+			_, err := c.GetAssetRequest(server.URL + "/files/asset.txt")
+			So(err, ShouldNotBeNil)
+			So(attempts, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestRequestCancellation(t *testing.T) {
+	Convey("Request cancellation", t, func() {
+		var attempts int32
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			<-release
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": []interface{}{}})
+		}))
+		defer server.Close()
+		defer close(release)
+
+		policy := DefaultRetryPolicy()
+		policy.InitialBackoff = time.Millisecond
+		c := &Container{Endpoint: server.URL + "/", RetryPolicy: policy}
+
+		Convey("cancels request in flight", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			db := &Database{Container: c, DatabaseID: "_public", Context: ctx}
+			time.AfterFunc(10*time.Millisecond, cancel)
+
+			_, err := db.QueryRecord(NewQuery("note"))
+			So(err, ShouldNotBeNil)
+			So(atomic.LoadInt32(&attempts), ShouldEqual, 1)
+		})
+
+		Convey("times out request", func() {
+			c.Timeout = 10 * time.Millisecond
+			policy.MaxAttempts = 2
+			db := &Database{Container: c, DatabaseID: "_public"}
+
+			_, err := db.FetchSchemaContext(context.Background())
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Request timed out after 10ms.")
+			So(atomic.LoadInt32(&attempts), ShouldEqual, 2)
+		})
+
+		Convey("does not time out asset download", func() {
+			c.Timeout = 10 * time.Millisecond
+			time.AfterFunc(50*time.Millisecond, func() {
+				release <- struct{}{}
+			})
+
+			_, err := c.GetAssetRequest(server.URL + "/files/asset.txt")
+			So(err, ShouldBeNil)
+			So(atomic.LoadInt32(&attempts), ShouldEqual, 1)
+		})
+	})
+}
@@ -15,19 +15,23 @@
 package container
 
 import (
-	"errors"
 	"fmt"
 	"mime"
 	"os"
 	"path/filepath"
 
 	skyrecord "github.com/skygeario/skycli/record"
+	"golang.org/x/net/context"
 )
 
 type SkyDB interface {
 	FetchRecord(string) (*skyrecord.Record, error)
-	QueryRecord(string) ([]*skyrecord.Record, error)
+	FetchRecords([]string) ([]*skyrecord.Record, []error, error)
+	QueryRecord(*Query) ([]*skyrecord.Record, error)
+	QueryRecordPage(*Query) ([]*skyrecord.Record, int, error)
+	CountRecords(*Query) (int, error)
 	SaveRecord(*skyrecord.Record) error
+	SaveRecords([]*skyrecord.Record) ([]error, error)
 	DeleteRecord([]string) error
 	FetchAsset(string) ([]byte, error)
 	SaveAsset(string) (string, error)
@@ -41,23 +45,38 @@ type SkyDB interface {
 type Database struct {
 	Container  *Container
 	DatabaseID string
+
+	// Context is used by the methods without a context parameter.
+	// context.Background() is used if it is nil.
+	Context context.Context
+}
+
+func (d *Database) context() context.Context {
+	if d.Context != nil {
+		return d.Context
+	}
+	return context.Background()
 }
 
-func (d *Database) FetchRecord(recordID string) (record *skyrecord.Record, err error) {
+// FetchRecord calls FetchRecordContext with the context of the database
+func (d *Database) FetchRecord(recordID string) (*skyrecord.Record, error) {
+	return d.FetchRecordContext(d.context(), recordID)
+}
+
+func (d *Database) FetchRecordContext(ctx context.Context, recordID string) (record *skyrecord.Record, err error) {
 	request := GenericRequest{}
 	request.Payload = map[string]interface{}{
 		"database_id": d.DatabaseID,
 		"ids":         []string{recordID},
 	}
 
-	response, err := d.Container.MakeRequest("record:fetch", &request)
+	response, err := d.Container.MakeRequestContext(ctx, "record:fetch", &request)
 	if err != nil {
 		return
 	}
 
 	if response.IsError() {
-		requestError := response.Error()
-		err = errors.New(requestError.Message)
+		err = response.Error()
 		return
 	}
 
@@ -75,7 +94,7 @@ func (d *Database) FetchRecord(recordID string) (record *skyrecord.Record, err e
 
 	if IsError(resultData) {
 		serverError := MakeError(resultData)
-		err = errors.New(serverError.Message)
+		err = &serverError
 		return
 	}
 
@@ -83,26 +102,95 @@ func (d *Database) FetchRecord(recordID string) (record *skyrecord.Record, err e
 	return
 }
 
-func (d *Database) QueryRecord(recordType string) ([]*skyrecord.Record, error) {
+// FetchRecords fetches the records in a single request. The records and
+// the errors of individual records are returned in the order of the IDs.
+// The record is nil if its error is not nil.
+func (d *Database) FetchRecords(recordIDList []string) ([]*skyrecord.Record, []error, error) {
+	return d.FetchRecordsContext(d.context(), recordIDList)
+}
+
+// FetchRecordsContext is FetchRecords with a context
+func (d *Database) FetchRecordsContext(ctx context.Context, recordIDList []string) ([]*skyrecord.Record, []error, error) {
 	request := GenericRequest{}
 	request.Payload = map[string]interface{}{
 		"database_id": d.DatabaseID,
-		"record_type": recordType,
+		"ids":         recordIDList,
 	}
 
-	response, err := d.Container.MakeRequest("record:query", &request)
+	response, err := d.Container.MakeRequestContext(ctx, "record:fetch", &request)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if response.IsError() {
+		return nil, nil, response.Error()
+	}
+
+	resultArray, ok := response.Payload["result"].([]interface{})
+	if !ok || len(resultArray) != len(recordIDList) {
+		return nil, nil, fmt.Errorf("Unexpected server data.")
+	}
+
+	recordList := make([]*skyrecord.Record, len(recordIDList))
+	errs := make([]error, len(recordIDList))
+	for i, result := range resultArray {
+		resultData, ok := result.(map[string]interface{})
+		if !ok {
+			errs[i] = fmt.Errorf("Unexpected server data.")
+			continue
+		}
+
+		if IsError(resultData) {
+			serverError := MakeError(resultData)
+			if serverError.ID == "" {
+				serverError.ID = recordIDList[i]
+			}
+			errs[i] = &serverError
+			continue
+		}
+
+		recordList[i], errs[i] = skyrecord.MakeRecord(resultData)
+	}
+	return recordList, errs, nil
+}
+
+// QueryRecord calls QueryRecordContext with the context of the database
+func (d *Database) QueryRecord(query *Query) ([]*skyrecord.Record, error) {
+	return d.QueryRecordContext(d.context(), query)
+}
+
+func (d *Database) QueryRecordContext(ctx context.Context, query *Query) ([]*skyrecord.Record, error) {
+	recordList, _, err := d.QueryRecordPageContext(ctx, query)
+	return recordList, err
+}
+
+// QueryRecordPage calls QueryRecordPageContext with the context of the
+// database
+func (d *Database) QueryRecordPage(query *Query) ([]*skyrecord.Record, int, error) {
+	return d.QueryRecordPageContext(d.context(), query)
+}
+
+// QueryRecordPageContext queries records like QueryRecordContext, and also
+// returns the number of results returned by the server, which includes
+// the results dropped because they cannot be parsed as records. If a
+// result is an error, the error is returned.
+func (d *Database) QueryRecordPageContext(ctx context.Context, query *Query) ([]*skyrecord.Record, int, error) {
+	request := GenericRequest{}
+	request.Payload = query.MakePayload()
+	request.Payload["database_id"] = d.DatabaseID
+
+	response, err := d.Container.MakeRequestContext(ctx, "record:query", &request)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	if response.IsError() {
-		requestError := response.Error()
-		return nil, errors.New(requestError.Message)
+		return nil, 0, response.Error()
 	}
 
 	resultArray, ok := response.Payload["result"].([]interface{})
 	if !ok {
-		return nil, fmt.Errorf("Unexpected server data.")
+		return nil, 0, fmt.Errorf("Unexpected server data.")
 	}
 
 	var recordList []*skyrecord.Record
@@ -115,8 +203,7 @@ func (d *Database) QueryRecord(recordType string) ([]*skyrecord.Record, error) {
 
 		if IsError(resultData) {
 			serverError := MakeError(resultData)
-			warn(serverError)
-			continue
+			return nil, len(resultArray), &serverError
 		}
 
 		record, err := skyrecord.MakeRecord(resultData)
@@ -128,24 +215,65 @@ func (d *Database) QueryRecord(recordType string) ([]*skyrecord.Record, error) {
 		recordList = append(recordList, record)
 	}
 
-	return recordList, nil
+	return recordList, len(resultArray), nil
+}
+
+// CountRecords returns the number of records matching the query without
+// fetching the records. Limit and offset of the query are ignored.
+func (d *Database) CountRecords(query *Query) (int, error) {
+	return d.CountRecordsContext(d.context(), query)
+}
+
+// CountRecordsContext is CountRecords with a context
+func (d *Database) CountRecordsContext(ctx context.Context, query *Query) (int, error) {
+	request := GenericRequest{}
+	request.Payload = query.MakePayload()
+	request.Payload["database_id"] = d.DatabaseID
+	request.Payload["count"] = true
+	request.Payload["limit"] = 0
+	delete(request.Payload, "offset")
+
+	response, err := d.Container.MakeRequestContext(ctx, "record:query", &request)
+	if err != nil {
+		return 0, err
+	}
+
+	if response.IsError() {
+		return 0, response.Error()
+	}
+
+	info, ok := response.Payload["info"].(map[string]interface{})
+	if !ok {
+		return 0, fmt.Errorf("Unexpected server data.")
+	}
+
+	count, ok := info["count"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("Unexpected server data.")
+	}
+
+	return int(count), nil
 }
 
-func (d *Database) SaveRecord(record *skyrecord.Record) (err error) {
+// SaveRecord calls SaveRecordContext with the context of the database
+func (d *Database) SaveRecord(record *skyrecord.Record) error {
+	return d.SaveRecordContext(d.context(), record)
+}
+
+func (d *Database) SaveRecordContext(ctx context.Context, record *skyrecord.Record) (err error) {
 	request := GenericRequest{}
 	request.Payload = map[string]interface{}{
 		"database_id": d.DatabaseID,
 		"records":     []skyrecord.Record{*record},
 	}
 
-	response, err := d.Container.MakeRequest("record:save", &request)
+	response, err := d.Container.MakeRequestContext(ctx, "record:save", &request)
 	if err != nil {
 		return
 	}
 
 	if response.IsError() {
-		requestError := response.Error()
-		err = errors.New(requestError.Message)
+		err = response.Error()
 		return
 	}
 
@@ -163,27 +291,85 @@ func (d *Database) SaveRecord(record *skyrecord.Record) (err error) {
 
 	if IsError(resultData) {
 		serverError := MakeError(resultData)
-		err = errors.New(serverError.Message)
+		err = &serverError
 		return
 	}
 	return
 }
 
+// SaveRecords saves the records in a single request. The errors of
+// individual records are returned in the order of the records, which are
+// nil for records saved successfully.
+func (d *Database) SaveRecords(recordList []*skyrecord.Record) ([]error, error) {
+	return d.SaveRecordsContext(d.context(), recordList)
+}
+
+// SaveRecordsContext is SaveRecords with a context
+func (d *Database) SaveRecordsContext(ctx context.Context, recordList []*skyrecord.Record) ([]error, error) {
+	records := make([]skyrecord.Record, len(recordList))
+	for i, record := range recordList {
+		records[i] = *record
+	}
+
+	request := GenericRequest{}
+	request.Payload = map[string]interface{}{
+		"database_id": d.DatabaseID,
+		"records":     records,
+		"atomic":      false,
+	}
+
+	response, err := d.Container.MakeRequestContext(ctx, "record:save", &request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.IsError() {
+		return nil, response.Error()
+	}
+
+	resultArray, ok := response.Payload["result"].([]interface{})
+	if !ok || len(resultArray) != len(recordList) {
+		return nil, fmt.Errorf("Unexpected server data.")
+	}
+
+	errs := make([]error, len(recordList))
+	for i, result := range resultArray {
+		resultData, ok := result.(map[string]interface{})
+		if !ok {
+			errs[i] = fmt.Errorf("Unexpected server data.")
+			continue
+		}
+
+		if IsError(resultData) {
+			serverError := MakeError(resultData)
+			if serverError.ID == "" {
+				serverError.ID = recordList[i].RecordID
+			}
+			errs[i] = &serverError
+		}
+	}
+	return errs, nil
+}
+
+// DeleteRecord calls DeleteRecordContext with the context of the database
 func (d *Database) DeleteRecord(recordIDList []string) error {
+	return d.DeleteRecordContext(d.context(), recordIDList)
+}
+
+func (d *Database) DeleteRecordContext(ctx context.Context, recordIDList []string) error {
 	request := GenericRequest{}
 	request.Payload = map[string]interface{}{
 		"database_id": d.DatabaseID,
 		"ids":         recordIDList,
 	}
 
-	response, err := d.Container.MakeRequest("record:delete", &request)
+	response, err := d.Container.MakeRequestContext(ctx, "record:delete", &request)
 	if err != nil {
 		return err
 	}
 
 	if response.IsError() {
-		requestError := response.Error()
-		return errors.New(requestError.Message)
+		return response.Error()
 	}
 
 	resultArray, ok := response.Payload["result"].([]interface{})
@@ -191,25 +377,37 @@ func (d *Database) DeleteRecord(recordIDList []string) error {
 		return fmt.Errorf("Unexpected server data.")
 	}
 
+	// The error of the first record failed to delete is returned, and
+	// the errors of the others are printed as warnings
+	var deleteErr error
 	for i := range resultArray {
 		resultData, ok := resultArray[i].(map[string]interface{})
 		if !ok {
-			warn(fmt.Errorf("Encountered unexpected server data."))
+			err = fmt.Errorf("Encountered unexpected server data.")
+		} else if IsError(resultData) {
+			serverError := MakeError(resultData)
+			err = &serverError
+		} else {
 			continue
 		}
 
-		if IsError(resultData) {
-			serverError := MakeError(resultData)
-			warn(serverError)
-			continue
+		if deleteErr == nil {
+			deleteErr = err
+		} else {
+			warn(err)
 		}
 	}
 
-	return nil
+	return deleteErr
+}
+
+// FetchAsset calls FetchAssetContext with the context of the database
+func (d *Database) FetchAsset(assetURL string) ([]byte, error) {
+	return d.FetchAssetContext(d.context(), assetURL)
 }
 
-func (d *Database) FetchAsset(assetURL string) (assetData []byte, err error) {
-	response, err := d.Container.GetAssetRequest(assetURL)
+func (d *Database) FetchAssetContext(ctx context.Context, assetURL string) (assetData []byte, err error) {
+	response, err := d.Container.GetAssetRequestContext(ctx, assetURL)
 	if err != nil {
 		return nil, err
 	}
@@ -217,7 +415,12 @@ func (d *Database) FetchAsset(assetURL string) (assetData []byte, err error) {
 	return response, nil
 }
 
-func (d *Database) SaveAsset(path string) (assetID string, err error) {
+// SaveAsset calls SaveAssetContext with the context of the database
+func (d *Database) SaveAsset(path string) (string, error) {
+	return d.SaveAssetContext(d.context(), path)
+}
+
+func (d *Database) SaveAssetContext(ctx context.Context, path string) (assetID string, err error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return
@@ -233,14 +436,13 @@ func (d *Database) SaveAsset(path string) (assetID string, err error) {
 	//TODO: Use other library to read mime type from content
 	filetype := mime.TypeByExtension(filepath.Ext(path))
 
-	response, err := d.Container.PutAssetRequest(filename, filetype, f)
+	response, err := d.Container.PutAssetRequestContext(ctx, filename, filetype, f)
 	if err != nil {
 		return
 	}
 
 	if response.IsError() {
-		requestError := response.Error()
-		err = errors.New(requestError.Message)
+		err = response.Error()
 		return
 	}
 
@@ -259,7 +461,12 @@ func (d *Database) SaveAsset(path string) (assetID string, err error) {
 	return
 }
 
+// RenameColumn calls RenameColumnContext with the context of the database
 func (d *Database) RenameColumn(recordType, oldName, newName string) error {
+	return d.RenameColumnContext(d.context(), recordType, oldName, newName)
+}
+
+func (d *Database) RenameColumnContext(ctx context.Context, recordType, oldName, newName string) error {
 	request := GenericRequest{}
 	request.Payload = map[string]interface{}{
 		"database_id": d.DatabaseID,
@@ -269,14 +476,13 @@ func (d *Database) RenameColumn(recordType, oldName, newName string) error {
 		"new_name":    newName,
 	}
 
-	response, err := d.Container.MakeRequest("schema:rename", &request)
+	response, err := d.Container.MakeRequestContext(ctx, "schema:rename", &request)
 	if err != nil {
 		return err
 	}
 
 	if response.IsError() {
-		requestError := response.Error()
-		err = errors.New(requestError.Message)
+		err = response.Error()
 		return err
 	}
 
@@ -284,7 +490,12 @@ func (d *Database) RenameColumn(recordType, oldName, newName string) error {
 	return nil
 }
 
+// DeleteColumn calls DeleteColumnContext with the context of the database
 func (d *Database) DeleteColumn(recordType, columnName string) error {
+	return d.DeleteColumnContext(d.context(), recordType, columnName)
+}
+
+func (d *Database) DeleteColumnContext(ctx context.Context, recordType, columnName string) error {
 	request := GenericRequest{}
 	request.Payload = map[string]interface{}{
 		"database_id": d.DatabaseID,
@@ -293,13 +504,12 @@ func (d *Database) DeleteColumn(recordType, columnName string) error {
 		"item_name":   columnName,
 	}
 
-	response, err := d.Container.MakeRequest("schema:delete", &request)
+	response, err := d.Container.MakeRequestContext(ctx, "schema:delete", &request)
 	if err != nil {
 		return err
 	}
 	if response.IsError() {
-		requestError := response.Error()
-		err = errors.New(requestError.Message)
+		err = response.Error()
 		return err
 	}
 
@@ -307,7 +517,12 @@ func (d *Database) DeleteColumn(recordType, columnName string) error {
 	return nil
 }
 
+// CreateColumn calls CreateColumnContext with the context of the database
 func (d *Database) CreateColumn(recordType, columnName, columnDef string) error {
+	return d.CreateColumnContext(d.context(), recordType, columnName, columnDef)
+}
+
+func (d *Database) CreateColumnContext(ctx context.Context, recordType, columnName, columnDef string) error {
 	request := GenericRequest{}
 	request.Payload = map[string]interface{}{
 		"database_id": d.DatabaseID,
@@ -323,13 +538,12 @@ func (d *Database) CreateColumn(recordType, columnName, columnDef string) error
 		},
 	}
 
-	response, err := d.Container.MakeRequest("schema:create", &request)
+	response, err := d.Container.MakeRequestContext(ctx, "schema:create", &request)
 	if err != nil {
 		return err
 	}
 	if response.IsError() {
-		requestError := response.Error()
-		err = errors.New(requestError.Message)
+		err = response.Error()
 		return err
 	}
 
@@ -337,20 +551,24 @@ func (d *Database) CreateColumn(recordType, columnName, columnDef string) error
 	return nil
 }
 
+// FetchSchema calls FetchSchemaContext with the context of the database
 func (d *Database) FetchSchema() (map[string]interface{}, error) {
+	return d.FetchSchemaContext(d.context())
+}
+
+func (d *Database) FetchSchemaContext(ctx context.Context) (map[string]interface{}, error) {
 	request := GenericRequest{}
 	request.Payload = map[string]interface{}{
 		"database_id": d.DatabaseID,
 	}
 
-	response, err := d.Container.MakeRequest("schema:fetch", &request)
+	response, err := d.Container.MakeRequestContext(ctx, "schema:fetch", &request)
 	if err != nil {
 		return nil, err
 	}
 
 	if response.IsError() {
-		requestError := response.Error()
-		return nil, errors.New(requestError.Message)
+		return nil, response.Error()
 	}
 
 	result, ok := response.Payload["result"].(map[string]interface{})
@@ -0,0 +1,105 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// DryRunner receives the requests which are not sent in dry-run mode.
+// The trace has the request fields only, with secrets redacted.
+type DryRunner interface {
+	DryRunRequest(trace *RequestTrace)
+}
+
+// mutatingActions are the actions not sent in dry-run mode
+var mutatingActions = map[string]bool{
+	"record:save":   true,
+	"record:delete": true,
+	"schema:create": true,
+	"schema:rename": true,
+	"schema:delete": true,
+}
+
+// IsMutatingAction returns whether the action modifies data on the server
+func IsMutatingAction(action string) bool {
+	return mutatingActions[action]
+}
+
+func (c *Container) dryRun(method, url, action string, header http.Header, body []byte) {
+	c.DryRun.DryRunRequest(&RequestTrace{
+		Action:        action,
+		Method:        method,
+		URL:           url,
+		RequestHeader: redactHeader(header),
+		RequestBody:   redactBody(body),
+	})
+}
+
+// dryRunResponse simulates a successful response to the payload of the
+// action
+func dryRunResponse(action string, payload []byte) (*SkygearResponse, error) {
+	var data map[string]interface{}
+	err := json.Unmarshal(payload, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	switch action {
+	case "record:save":
+		records, _ := data["records"].([]interface{})
+		for _, record := range records {
+			if recordData, ok := record.(map[string]interface{}); ok {
+				recordData["_type"] = "record"
+			}
+		}
+		result = records
+	case "record:delete":
+		ids, _ := data["ids"].([]interface{})
+		results := []interface{}{}
+		for _, id := range ids {
+			results = append(results, map[string]interface{}{
+				"_id":   id,
+				"_type": "record",
+			})
+		}
+		result = results
+	default:
+		result = map[string]interface{}{
+			"record_types": map[string]interface{}{},
+		}
+	}
+
+	return &SkygearResponse{
+		Payload: map[string]interface{}{
+			"result": result,
+		},
+	}, nil
+}
+
+// dryRunAssetResponse simulates a successful response to uploading the
+// asset, which is named after the file
+func dryRunAssetResponse(filename string) *SkygearResponse {
+	return &SkygearResponse{
+		Payload: map[string]interface{}{
+			"result": map[string]interface{}{
+				"$type": "asset",
+				"$name": filename,
+			},
+		},
+	}
+}
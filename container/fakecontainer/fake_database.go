@@ -19,7 +19,9 @@ import (
 	"encoding/gob"
 	"fmt"
 	"strings"
+	"sync"
 
+	skycontainer "github.com/skygeario/skycli/container"
 	skyrecord "github.com/skygeario/skycli/record"
 	"github.com/twinj/uuid"
 )
@@ -28,12 +30,20 @@ import (
 type FakeDatabase struct {
 	RecordList map[string]map[string]*skyrecord.Record
 	AssetList  map[string][]byte
+	// Schema maps record type to the list of its fields, in the format
+	// of schema:fetch
+	Schema map[string]interface{}
+
+	// mutex guards saving records and assets, which are done
+	// concurrently by record import
+	mutex sync.Mutex
 }
 
 func NewFakeDatabase() *FakeDatabase {
 	return &FakeDatabase{
 		RecordList: make(map[string]map[string]*skyrecord.Record),
 		AssetList:  make(map[string][]byte),
+		Schema:     make(map[string]interface{}),
 	}
 }
 
@@ -41,6 +51,16 @@ func fakeDatabaseError() error {
 	return fmt.Errorf("FakeDatabase Error.")
 }
 
+// fakeNotFoundError returns the error returned by Skygear when the record
+// is not found
+func fakeNotFoundError() error {
+	return &skycontainer.SkygearError{
+		Name:    "ResourceNotFound",
+		Code:    skycontainer.ResourceNotFound,
+		Message: "record not found",
+	}
+}
+
 func (d *FakeDatabase) FetchRecord(recordID string) (*skyrecord.Record, error) {
 	args := strings.Split(recordID, "/")
 	if len(args) != 2 {
@@ -51,28 +71,123 @@ func (d *FakeDatabase) FetchRecord(recordID string) (*skyrecord.Record, error) {
 
 	record, ok := d.RecordList[recordType][recordKey]
 	if !ok {
-		return nil, fakeDatabaseError()
+		return nil, fakeNotFoundError()
 	}
 	return record, nil
 }
 
-func (d *FakeDatabase) QueryRecord(recordType string) ([]*skyrecord.Record, error) {
+// FetchRecords fetches the records one by one
+func (d *FakeDatabase) FetchRecords(recordIDList []string) ([]*skyrecord.Record, []error, error) {
+	recordList := make([]*skyrecord.Record, len(recordIDList))
+	errs := make([]error, len(recordIDList))
+	for i, recordID := range recordIDList {
+		recordList[i], errs[i] = d.FetchRecord(recordID)
+	}
+	return recordList, errs, nil
+}
+
+func (d *FakeDatabase) QueryRecord(query *skycontainer.Query) ([]*skyrecord.Record, error) {
 	var recordList []*skyrecord.Record
-	records, ok := d.RecordList[recordType]
+	records, ok := d.RecordList[query.RecordType]
 	if !ok {
 		return nil, nil
 	}
 
 	for _, record := range records {
-		recordList = append(recordList, record)
+		matched, err := matchPredicate(record, query.Predicate())
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			recordList = append(recordList, d.includeRecords(record, query.Includes))
+		}
+	}
+
+	sortRecords(recordList, query.Sorts)
+
+	if query.Offset > 0 {
+		if query.Offset >= len(recordList) {
+			return nil, nil
+		}
+		recordList = recordList[query.Offset:]
+	}
+	if query.Limit > 0 && query.Limit < len(recordList) {
+		recordList = recordList[:query.Limit]
 	}
 	return recordList, nil
 }
 
+func (d *FakeDatabase) QueryRecordPage(query *skycontainer.Query) ([]*skyrecord.Record, int, error) {
+	recordList, err := d.QueryRecord(query)
+	return recordList, len(recordList), err
+}
+
+// includeRecords returns a copy of the record with the records referenced by
+// the include keys in `_transient`, as Skygear does
+func (d *FakeDatabase) includeRecords(record *skyrecord.Record, includes []string) *skyrecord.Record {
+	if len(includes) == 0 {
+		return record
+	}
+
+	cpy := &skyrecord.Record{
+		RecordID: record.RecordID,
+		Data:     map[string]interface{}{},
+	}
+	for k, v := range record.Data {
+		cpy.Data[k] = v
+	}
+
+	transient := map[string]interface{}{}
+	for _, key := range includes {
+		ref, ok := record.Data[key].(map[string]interface{})
+		if !ok || ref["$type"] != "ref" {
+			continue
+		}
+		refID, _ := ref["$id"].(string)
+		referenced, err := d.FetchRecord(refID)
+		if err != nil {
+			continue
+		}
+
+		data := map[string]interface{}{"_id": referenced.RecordID}
+		for k, v := range referenced.Data {
+			data[k] = v
+		}
+		transient[key] = data
+	}
+	cpy.Data["_transient"] = transient
+	return cpy
+}
+
+func (d *FakeDatabase) CountRecords(query *skycontainer.Query) (int, error) {
+	countQuery := *query
+	countQuery.Limit = 0
+	countQuery.Offset = 0
+
+	recordList, err := d.QueryRecord(&countQuery)
+	if err != nil {
+		return 0, err
+	}
+	return len(recordList), nil
+}
+
+// SaveRecords saves the records one by one
+func (d *FakeDatabase) SaveRecords(recordList []*skyrecord.Record) ([]error, error) {
+	errs := make([]error, len(recordList))
+	for i, record := range recordList {
+		errs[i] = d.SaveRecord(record)
+	}
+	return errs, nil
+}
+
 func (d *FakeDatabase) SaveRecord(r *skyrecord.Record) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	// Deep clone the record to prevent changing the original one
 	var mod bytes.Buffer
 	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
 	enc := gob.NewEncoder(&mod)
 	dec := gob.NewDecoder(&mod)
 	err := enc.Encode(*r)
@@ -116,6 +231,9 @@ func (d *FakeDatabase) DeleteRecord(recordIDList []string) error {
 		if _, ok := d.RecordList[recordType]; !ok {
 			return fakeDatabaseError()
 		}
+		if _, ok := d.RecordList[recordType][recordKey]; !ok {
+			return fakeNotFoundError()
+		}
 
 		delete(d.RecordList[recordType], recordKey)
 	}
@@ -131,6 +249,9 @@ func (d *FakeDatabase) FetchAsset(assetID string) ([]byte, error) {
 }
 
 func (d *FakeDatabase) SaveAsset(path string) (string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	if path == "err" {
 		return "", fakeDatabaseError()
 	}
@@ -142,18 +263,54 @@ func (d *FakeDatabase) SaveAsset(path string) (string, error) {
 	return assetID, nil
 }
 
+func (d *FakeDatabase) fields(recordType string) []interface{} {
+	recordSchema, ok := d.Schema[recordType].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	fields, _ := recordSchema["fields"].([]interface{})
+	return fields
+}
+
+func (d *FakeDatabase) setFields(recordType string, fields []interface{}) {
+	d.Schema[recordType] = map[string]interface{}{"fields": fields}
+}
+
 func (d *FakeDatabase) CreateColumn(recordType, columnName, columnDef string) error {
+	fields := d.fields(recordType)
+	for _, f := range fields {
+		if f.(map[string]interface{})["name"] == columnName {
+			return fakeDatabaseError()
+		}
+	}
+
+	fields = append(fields, map[string]interface{}{"name": columnName, "type": columnDef})
+	d.setFields(recordType, fields)
 	return nil
 }
 
 func (d *FakeDatabase) RenameColumn(recordType, oldName, newName string) error {
-	return nil
+	for _, f := range d.fields(recordType) {
+		field := f.(map[string]interface{})
+		if field["name"] == oldName {
+			field["name"] = newName
+			return nil
+		}
+	}
+	return fakeDatabaseError()
 }
 
 func (d *FakeDatabase) DeleteColumn(recordType, columnName string) error {
-	return nil
+	fields := d.fields(recordType)
+	for i, f := range fields {
+		if f.(map[string]interface{})["name"] == columnName {
+			d.setFields(recordType, append(fields[:i], fields[i+1:]...))
+			return nil
+		}
+	}
+	return fakeDatabaseError()
 }
 
 func (d *FakeDatabase) FetchSchema() (map[string]interface{}, error) {
-	return nil, nil
+	return d.Schema, nil
 }
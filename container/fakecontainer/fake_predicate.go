@@ -0,0 +1,266 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakecontainer
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	skycontainer "github.com/skygeario/skycli/container"
+	skyrecord "github.com/skygeario/skycli/record"
+)
+
+const earthRadius = 6371000.0
+
+// matchPredicate evaluates a Skygear predicate against a record, in
+// a simplified manner good enough for testing
+func matchPredicate(record *skyrecord.Record, predicate []interface{}) (bool, error) {
+	if len(predicate) == 0 {
+		return true, nil
+	}
+
+	operator, ok := predicate[0].(string)
+	if !ok {
+		return false, fmt.Errorf("Unexpected predicate: %v", predicate)
+	}
+
+	switch operator {
+	case "and", "or":
+		for _, p := range predicate[1:] {
+			sub, err := toPredicate(p)
+			if err != nil {
+				return false, err
+			}
+			matched, err := matchPredicate(record, sub)
+			if err != nil {
+				return false, err
+			}
+			if operator == "and" && !matched {
+				return false, nil
+			}
+			if operator == "or" && matched {
+				return true, nil
+			}
+		}
+		return operator == "and", nil
+	case "not":
+		if len(predicate) != 2 {
+			return false, fmt.Errorf("Unexpected predicate: %v", predicate)
+		}
+		sub, err := toPredicate(predicate[1])
+		if err != nil {
+			return false, err
+		}
+		matched, err := matchPredicate(record, sub)
+		return !matched, err
+	}
+
+	if len(predicate) != 3 {
+		return false, fmt.Errorf("Unexpected predicate: %v", predicate)
+	}
+
+	lhs, err := evaluate(record, predicate[1])
+	if err != nil {
+		return false, err
+	}
+	rhs := predicate[2]
+
+	switch operator {
+	case "eq":
+		return reflect.DeepEqual(normalize(lhs), normalize(rhs)), nil
+	case "neq":
+		return !reflect.DeepEqual(normalize(lhs), normalize(rhs)), nil
+	case "gt", "gte", "lt", "lte":
+		return compare(operator, lhs, rhs), nil
+	case "like", "ilike":
+		lhsStr, ok1 := lhs.(string)
+		pattern, ok2 := rhs.(string)
+		if !ok1 || !ok2 {
+			return false, nil
+		}
+		return likeRegexp(pattern, operator == "ilike").MatchString(lhsStr), nil
+	case "in":
+		values, ok := rhs.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("Unexpected predicate: %v", predicate)
+		}
+		for _, v := range values {
+			if reflect.DeepEqual(normalize(lhs), normalize(v)) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return false, fmt.Errorf("Unsupported predicate operator: %s", operator)
+}
+
+func toPredicate(value interface{}) ([]interface{}, error) {
+	switch p := value.(type) {
+	case skycontainer.Predicate:
+		return p, nil
+	case []interface{}:
+		return p, nil
+	}
+	return nil, fmt.Errorf("Unexpected predicate: %v", value)
+}
+
+// evaluate resolves keypath and function expressions to a value
+func evaluate(record *skyrecord.Record, expr interface{}) (interface{}, error) {
+	switch e := expr.(type) {
+	case map[string]interface{}:
+		if e["$type"] == "keypath" {
+			key, _ := e["$val"].(string)
+			if key == "_id" {
+				parts := strings.SplitN(record.RecordID, "/", 2)
+				return parts[len(parts)-1], nil
+			}
+			return record.Data[key], nil
+		}
+	case []interface{}:
+		if len(e) == 4 && e[0] == "func" && e[1] == "distance" {
+			location, err := evaluate(record, e[2])
+			if err != nil {
+				return nil, err
+			}
+			return distance(location, e[3])
+		}
+	}
+	return nil, fmt.Errorf("Unsupported expression: %v", expr)
+}
+
+func distance(a, b interface{}) (interface{}, error) {
+	aMap, ok1 := a.(map[string]interface{})
+	bMap, ok2 := b.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return nil, nil
+	}
+
+	lat1, _ := aMap["$lat"].(float64)
+	lng1, _ := aMap["$lng"].(float64)
+	lat2, _ := bMap["$lat"].(float64)
+	lng2, _ := bMap["$lng"].(float64)
+
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h)), nil
+}
+
+// normalize converts all numeric values to float64 for comparison
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return value
+}
+
+func compare(operator string, lhs, rhs interface{}) bool {
+	var cmp int
+	lhs, rhs = normalize(lhs), normalize(rhs)
+	switch l := lhs.(type) {
+	case float64:
+		r, ok := rhs.(float64)
+		if !ok {
+			return false
+		}
+		if l < r {
+			cmp = -1
+		} else if l > r {
+			cmp = 1
+		}
+	case string:
+		r, ok := rhs.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return false
+	}
+
+	switch operator {
+	case "gt":
+		return cmp > 0
+	case "gte":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	case "lte":
+		return cmp <= 0
+	}
+	return false
+}
+
+func likeRegexp(pattern string, caseInsensitive bool) *regexp.Regexp {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, "%", ".*", -1)
+	expr = strings.Replace(expr, "_", ".", -1)
+	expr = "^" + expr + "$"
+	if caseInsensitive {
+		expr = "(?i)" + expr
+	}
+	return regexp.MustCompile(expr)
+}
+
+// sortValue returns the value of the record to be sorted by key
+func sortValue(record *skyrecord.Record, key string) interface{} {
+	if key == "_id" {
+		return record.RecordID
+	}
+	return record.Data[key]
+}
+
+type recordSorter struct {
+	recordList []*skyrecord.Record
+	sorts      []skycontainer.Sort
+}
+
+func (s *recordSorter) Len() int {
+	return len(s.recordList)
+}
+
+func (s *recordSorter) Swap(i, j int) {
+	s.recordList[i], s.recordList[j] = s.recordList[j], s.recordList[i]
+}
+
+func (s *recordSorter) Less(i, j int) bool {
+	for _, sort := range s.sorts {
+		lhs, rhs := sortValue(s.recordList[i], sort.Key), sortValue(s.recordList[j], sort.Key)
+		if reflect.DeepEqual(normalize(lhs), normalize(rhs)) {
+			continue
+		}
+		if sort.Order == skycontainer.Descending {
+			return compare("gt", lhs, rhs)
+		}
+		return compare("lt", lhs, rhs)
+	}
+	return s.recordList[i].RecordID < s.recordList[j].RecordID
+}
+
+// sortRecords sorts records by the sort keys, and then by record ID so that
+// the order is always deterministic
+func sortRecords(recordList []*skyrecord.Record, sorts []skycontainer.Sort) {
+	sort.Sort(&recordSorter{recordList: recordList, sorts: sorts})
+}
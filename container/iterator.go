@@ -0,0 +1,121 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	skyrecord "github.com/skygeario/skycli/record"
+)
+
+// DefaultPageSize is the number of records fetched in each query
+// by a RecordIterator if page size is not specified
+const DefaultPageSize = 100
+
+// RecordIterator iterates through all records matching a query, fetching
+// one page of records at a time so that the whole result set does not
+// need to be kept in memory.
+//
+// Records are sorted by record ID after the sorts of the query, so that
+// records with the same values of the sort keys are in the same order in
+// every page.
+type RecordIterator struct {
+	db        SkyDB
+	query     Query
+	pageSize  int
+	remaining int
+	page      []*skyrecord.Record
+	index     int
+	done      bool
+	err       error
+}
+
+// NewRecordIterator creates an iterator of the records matching the query.
+// If the query has a limit, at most that number of records is returned.
+func NewRecordIterator(db SkyDB, query *Query, pageSize int) *RecordIterator {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	pageQuery := *query
+	pageQuery.Sorts = append([]Sort{}, query.Sorts...)
+	pageQuery.AddAscending("_id")
+
+	return &RecordIterator{
+		db:        db,
+		query:     pageQuery,
+		pageSize:  pageSize,
+		remaining: query.Limit,
+		index:     -1,
+	}
+}
+
+func (it *RecordIterator) fetchPage() {
+	limit := it.pageSize
+	if it.query.Limit > 0 && it.remaining < limit {
+		limit = it.remaining
+	}
+
+	pageQuery := it.query
+	pageQuery.Limit = limit
+
+	// Results dropped by the database still count towards the offset,
+	// so that the next page starts where the server stopped
+	var count int
+	it.page, count, it.err = it.db.QueryRecordPage(&pageQuery)
+	it.index = 0
+	if it.err != nil {
+		it.done = true
+		return
+	}
+
+	it.query.Offset += count
+	if it.query.Limit > 0 {
+		it.remaining -= count
+	}
+	if count < limit || (it.query.Limit > 0 && it.remaining <= 0) {
+		it.done = true
+	}
+}
+
+// Next advances the iterator to the next record. It returns false when
+// there are no more records or an error occurred.
+func (it *RecordIterator) Next() bool {
+	it.index++
+	for it.index >= len(it.page) {
+		if it.done {
+			it.page = nil
+			return false
+		}
+		it.fetchPage()
+	}
+	return true
+}
+
+// Record returns the current record of the iterator
+func (it *RecordIterator) Record() *skyrecord.Record {
+	if it.index < 0 || it.index >= len(it.page) {
+		return nil
+	}
+	return it.page[it.index]
+}
+
+// Offset returns the number of records fetched so far
+func (it *RecordIterator) Offset() int {
+	return it.query.Offset
+}
+
+// Err returns the error occurred during iteration, if any
+func (it *RecordIterator) Err() error {
+	return it.err
+}
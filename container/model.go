@@ -44,32 +44,63 @@ func (r *SkygearResponse) IsError() bool {
 
 // Error returns error in the response if any
 func (r *SkygearResponse) Error() *SkygearError {
+	if !r.IsError() {
+		return nil
+	}
 	data, ok := r.Payload["error"].(map[string]interface{})
 	if !ok {
-		return nil
+		data = map[string]interface{}{}
 	}
 	skygearError := MakeError(data)
 	return &skygearError
 }
 
+// Codes of common Skygear errors
+const (
+	NotAuthenticated       = 101
+	PermissionDenied       = 102
+	AccessKeyNotAccepted   = 103
+	AccessTokenNotAccepted = 104
+	InvalidCredentials     = 105
+	InvalidSignature       = 106
+	BadRequest             = 107
+	InvalidArgument        = 108
+	Duplicated             = 109
+	ResourceNotFound       = 110
+	NotSupported           = 111
+	NotImplemented         = 112
+	ConstraintViolated     = 113
+	UnexpectedError        = 10000
+)
+
 // SkygearError encapsulates data of an Skygear response
 type SkygearError struct {
 	ID      string
+	Name    string
 	Message string
 	Code    int
 	Type    string
+	Info    map[string]interface{}
 }
 
 // MakeError creates an SkygearError
 func MakeError(data map[string]interface{}) SkygearError {
 	err := SkygearError{}
 	err.ID, _ = data["_id"].(string)
+	err.Name, _ = data["name"].(string)
 	err.Message, _ = data["message"].(string)
 	if err.Message == "" {
 		err.Message = "Unknown Error"
 	}
-	err.Code, _ = data["code"].(int)
+	// JSON numbers are decoded as float64
+	switch code := data["code"].(type) {
+	case float64:
+		err.Code = int(code)
+	case int:
+		err.Code = code
+	}
 	err.Type, _ = data["type"].(string)
+	err.Info, _ = data["info"].(map[string]interface{})
 	return err
 }
 
@@ -0,0 +1,208 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+// Predicate is a query condition in the Skygear predicate format, e.g.
+// ["eq", {"$type": "keypath", "$val": "name"}, "Alice"]
+type Predicate []interface{}
+
+// SortOrder is the order of records sorted by an attribute
+type SortOrder string
+
+const (
+	// Ascending sorts records from the smallest value
+	Ascending SortOrder = "asc"
+	// Descending sorts records from the largest value
+	Descending SortOrder = "desc"
+)
+
+// Sort describes sorting records by an attribute
+type Sort struct {
+	Key   string
+	Order SortOrder
+}
+
+// Query encapsulates the parameters of a record:query request
+type Query struct {
+	RecordType string
+	Predicates []Predicate
+	Sorts      []Sort
+
+	// Includes are the reference attributes whose referenced records are
+	// returned together with the records, in the `_transient` attribute.
+	Includes []string
+
+	// Limit is the maximum number of records returned. Zero means
+	// using the server default.
+	Limit  int
+	Offset int
+}
+
+// NewQuery creates a query matching all records of a record type
+func NewQuery(recordType string) *Query {
+	return &Query{
+		RecordType: recordType,
+	}
+}
+
+// KeyPath creates the keypath value referring to a record attribute
+func KeyPath(key string) map[string]interface{} {
+	return map[string]interface{}{
+		"$type": "keypath",
+		"$val":  key,
+	}
+}
+
+// Where adds a predicate to the query. All predicates of a query must be
+// satisfied by a record for it to be returned.
+func (q *Query) Where(predicate Predicate) *Query {
+	q.Predicates = append(q.Predicates, predicate)
+	return q
+}
+
+func (q *Query) compare(operator, key string, value interface{}) *Query {
+	return q.Where(Predicate{operator, KeyPath(key), value})
+}
+
+// Equal adds a condition that the attribute equals the value
+func (q *Query) Equal(key string, value interface{}) *Query {
+	return q.compare("eq", key, value)
+}
+
+// NotEqual adds a condition that the attribute does not equal the value
+func (q *Query) NotEqual(key string, value interface{}) *Query {
+	return q.compare("neq", key, value)
+}
+
+// GreaterThan adds a condition that the attribute is greater than the value
+func (q *Query) GreaterThan(key string, value interface{}) *Query {
+	return q.compare("gt", key, value)
+}
+
+// GreaterThanOrEqual adds a condition that the attribute is greater than
+// or equal to the value
+func (q *Query) GreaterThanOrEqual(key string, value interface{}) *Query {
+	return q.compare("gte", key, value)
+}
+
+// LessThan adds a condition that the attribute is less than the value
+func (q *Query) LessThan(key string, value interface{}) *Query {
+	return q.compare("lt", key, value)
+}
+
+// LessThanOrEqual adds a condition that the attribute is less than or
+// equal to the value
+func (q *Query) LessThanOrEqual(key string, value interface{}) *Query {
+	return q.compare("lte", key, value)
+}
+
+// Like adds a condition that the attribute matches the pattern, where `%`
+// matches any sequence of characters and `_` matches a single character
+func (q *Query) Like(key string, pattern string) *Query {
+	return q.compare("like", key, pattern)
+}
+
+// CaseInsensitiveLike is the case insensitive version of Like
+func (q *Query) CaseInsensitiveLike(key string, pattern string) *Query {
+	return q.compare("ilike", key, pattern)
+}
+
+// In adds a condition that the attribute equals one of the values
+func (q *Query) In(key string, values []interface{}) *Query {
+	return q.compare("in", key, values)
+}
+
+// DistanceLessThan adds a condition that the location attribute is within
+// distance (in meters) of the location at lat, lng
+func (q *Query) DistanceLessThan(key string, lat, lng, distance float64) *Query {
+	location := map[string]interface{}{
+		"$type": "geo",
+		"$lat":  lat,
+		"$lng":  lng,
+	}
+	return q.Where(Predicate{
+		"lt",
+		[]interface{}{"func", "distance", KeyPath(key), location},
+		distance,
+	})
+}
+
+// AddAscending sorts the records by the attribute in ascending order.
+// Records are sorted by the first added attribute first.
+func (q *Query) AddAscending(key string) *Query {
+	q.Sorts = append(q.Sorts, Sort{Key: key, Order: Ascending})
+	return q
+}
+
+// AddDescending sorts the records by the attribute in descending order
+func (q *Query) AddDescending(key string) *Query {
+	q.Sorts = append(q.Sorts, Sort{Key: key, Order: Descending})
+	return q
+}
+
+// Include fetches the records referenced by the reference attribute
+// together with the queried records
+func (q *Query) Include(key string) *Query {
+	q.Includes = append(q.Includes, key)
+	return q
+}
+
+// Predicate returns the predicate combining all conditions of the query,
+// or nil if the query has no condition.
+func (q *Query) Predicate() Predicate {
+	switch len(q.Predicates) {
+	case 0:
+		return nil
+	case 1:
+		return q.Predicates[0]
+	}
+
+	predicate := Predicate{"and"}
+	for _, p := range q.Predicates {
+		predicate = append(predicate, p)
+	}
+	return predicate
+}
+
+// MakePayload creates request payload for a record query
+func (q *Query) MakePayload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"record_type": q.RecordType,
+	}
+	if predicate := q.Predicate(); predicate != nil {
+		payload["predicate"] = predicate
+	}
+	if len(q.Sorts) > 0 {
+		sorts := []interface{}{}
+		for _, sort := range q.Sorts {
+			sorts = append(sorts, []interface{}{KeyPath(sort.Key), string(sort.Order)})
+		}
+		payload["sort"] = sorts
+	}
+	if len(q.Includes) > 0 {
+		includes := map[string]interface{}{}
+		for _, key := range q.Includes {
+			includes[key] = KeyPath(key)
+		}
+		payload["include"] = includes
+	}
+	if q.Limit > 0 {
+		payload["limit"] = q.Limit
+	}
+	if q.Offset > 0 {
+		payload["offset"] = q.Offset
+	}
+	return payload
+}
@@ -0,0 +1,146 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried.
+//
+// A request failed with a network error is retried if it is idempotent,
+// or if the connection was never made so that the request cannot have
+// reached the server. A request failed with one of RetryStatusCodes or
+// RetryErrorCodes is retried only if it is idempotent.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first
+	// one
+	MaxAttempts int
+
+	// InitialBackoff is the upper bound of the delay before the first
+	// retry. The upper bound doubles for each retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// RetryStatusCodes are the HTTP status codes to retry on
+	RetryStatusCodes []int
+
+	// RetryErrorCodes are the Skygear error codes to retry on
+	RetryErrorCodes []int
+
+	// IdempotentActions are the actions that can be sent again safely
+	IdempotentActions map[string]bool
+}
+
+// DefaultRetryPolicy returns the retry policy used by skycli
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:      4,
+		InitialBackoff:   200 * time.Millisecond,
+		MaxBackoff:       5 * time.Second,
+		RetryStatusCodes: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		IdempotentActions: map[string]bool{
+			"me":           true,
+			"auth:login":   true,
+			"auth:logout":  true,
+			"record:fetch": true,
+			"record:query": true,
+			// records are always saved with their IDs, so saving the
+			// same records again gives the same result
+			"record:save":  true,
+			"schema:fetch": true,
+			// record:delete is not idempotent, since deleting records
+			// deleted by a lost attempt fails with not found
+		},
+	}
+}
+
+var jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+var jitterMutex sync.Mutex
+
+// backoff returns the delay before the retry following the attempt. The
+// delay is chosen randomly up to the upper bound of the attempt, so that
+// clients failed at the same time do not retry at the same time.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	bound := p.InitialBackoff
+	for i := 1; i < attempt && bound < p.MaxBackoff; i++ {
+		bound *= 2
+	}
+	if bound > p.MaxBackoff {
+		bound = p.MaxBackoff
+	}
+	if bound <= 0 {
+		return 0
+	}
+
+	jitterMutex.Lock()
+	defer jitterMutex.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(bound)))
+}
+
+func (p *RetryPolicy) shouldRetry(idempotent bool, statusCode int, body []byte, err error) bool {
+	if err != nil {
+		return idempotent || isDialError(err)
+	}
+	if !idempotent {
+		return false
+	}
+
+	for _, code := range p.RetryStatusCodes {
+		if statusCode == code {
+			return true
+		}
+	}
+
+	if statusCode >= 400 && len(p.RetryErrorCodes) > 0 {
+		errorCode := responseErrorCode(body)
+		for _, code := range p.RetryErrorCodes {
+			if errorCode == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isDialError returns whether the error occurred when connecting to the
+// server
+func isDialError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// responseErrorCode returns the Skygear error code in the response body,
+// or 0 if there is none
+func responseErrorCode(body []byte) int {
+	var data struct {
+		Error struct {
+			Code float64 `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &data) != nil {
+		return 0
+	}
+	return int(data.Error.Code)
+}
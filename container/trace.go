@@ -0,0 +1,113 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Redacted replaces secrets in traced requests and responses
+const Redacted = "REDACTED"
+
+// redactedHeaders are the headers containing secrets
+var redactedHeaders = []string{"X-Skygear-API-Key", "X-Skygear-Access-Token"}
+
+// redactedKeys are the JSON keys containing secrets
+var redactedKeys = map[string]bool{
+	"access_token": true,
+	"api_key":      true,
+	"password":     true,
+}
+
+// RequestTrace records a request sent by a container and its response.
+// Secrets in headers and JSON bodies are redacted.
+type RequestTrace struct {
+	// Action is the Skygear action of the request. It is empty for
+	// asset requests.
+	Action string
+	// Attempt is the number of the attempt when the request is retried
+	Attempt int
+
+	Method        string
+	URL           string
+	RequestHeader http.Header
+	// RequestBody is nil for asset uploads
+	RequestBody []byte
+
+	StatusCode     int
+	ResponseHeader http.Header
+	ResponseBody   []byte
+	Err            error
+
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// RequestTracer receives the traces of the requests sent by a container
+type RequestTracer interface {
+	TraceRequest(trace *RequestTrace)
+}
+
+func redactHeader(header http.Header) http.Header {
+	redacted := http.Header{}
+	for name, values := range header {
+		redacted[name] = values
+	}
+	for _, name := range redactedHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, Redacted)
+		}
+	}
+	return redacted
+}
+
+func redactValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		redacted := map[string]interface{}{}
+		for key, item := range value {
+			if _, ok := item.(string); ok && redactedKeys[key] {
+				redacted[key] = Redacted
+			} else {
+				redacted[key] = redactValue(item)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(value))
+		for i, item := range value {
+			redacted[i] = redactValue(item)
+		}
+		return redacted
+	}
+	return value
+}
+
+// redactBody returns the JSON body with secrets redacted. Bodies that
+// are not JSON objects are returned unchanged.
+func redactBody(body []byte) []byte {
+	var data map[string]interface{}
+	if json.Unmarshal(body, &data) != nil {
+		return body
+	}
+
+	redacted, err := json.Marshal(redactValue(data))
+	if err != nil {
+		return body
+	}
+	return redacted
+}
@@ -0,0 +1,267 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package record
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is a key of an object or an index of an array in a path
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath splits a path to a nested value (e.g. meta.address.city or
+// tags[0]) into segments
+func parsePath(path string) ([]pathSegment, error) {
+	var segments []pathSegment
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		var indexes []int
+		if bracket := strings.Index(part, "["); bracket >= 0 {
+			key = part[:bracket]
+			rest := part[bracket:]
+			for rest != "" {
+				end := strings.Index(rest, "]")
+				if !strings.HasPrefix(rest, "[") || end < 0 {
+					return nil, fmt.Errorf("Path '%s' not in correct format.", path)
+				}
+				index, err := strconv.Atoi(rest[1:end])
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("Path '%s' has invalid index '%s'.", path, rest[1:end])
+				}
+				indexes = append(indexes, index)
+				rest = rest[end+1:]
+			}
+		}
+
+		if key == "" {
+			return nil, fmt.Errorf("Path '%s' not in correct format.", path)
+		}
+		segments = append(segments, pathSegment{key: key})
+		for _, index := range indexes {
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+		}
+	}
+	return segments, nil
+}
+
+// CheckPath checks if the path is in correct format and can be set by the
+// user
+func CheckPath(path string) error {
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	return checkKey(segments[0].key)
+}
+
+// IsNestedPath returns whether the path refers to a value nested in a
+// top-level key
+func IsNestedPath(path string) bool {
+	return strings.ContainsAny(path, ".[")
+}
+
+// PathKey returns the top-level key of the path
+func PathKey(path string) string {
+	if i := strings.IndexAny(path, ".["); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// pathString returns the path of the first n segments for error messages
+func pathString(segments []pathSegment, n int) string {
+	var path string
+	for _, segment := range segments[:n] {
+		if segment.isIndex {
+			path += fmt.Sprintf("[%d]", segment.index)
+		} else if path == "" {
+			path = segment.key
+		} else {
+			path += "." + segment.key
+		}
+	}
+	return path
+}
+
+// GetPath gets the value at the path in the record. An empty string is
+// returned if there is no value at the path, like Get.
+func (r *Record) GetPath(path string) (interface{}, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{} = r.Data
+	for i, segment := range segments {
+		switch container := value.(type) {
+		case map[string]interface{}:
+			if segment.isIndex {
+				return nil, fmt.Errorf("%s is not an array.", pathString(segments, i))
+			}
+			var ok bool
+			value, ok = container[segment.key]
+			if !ok {
+				return "", nil
+			}
+		case []interface{}:
+			if !segment.isIndex {
+				return nil, fmt.Errorf("%s is not an object.", pathString(segments, i))
+			}
+			if segment.index >= len(container) {
+				return "", nil
+			}
+			value = container[segment.index]
+		case nil:
+			return "", nil
+		default:
+			if segment.isIndex {
+				return nil, fmt.Errorf("%s is not an array.", pathString(segments, i))
+			}
+			return nil, fmt.Errorf("%s is not an object.", pathString(segments, i))
+		}
+	}
+	return value, nil
+}
+
+// setSegments sets value at the segments in container, returning the
+// modified container. Missing objects and arrays are created. The value
+// is removed if remove is true.
+func setSegments(container interface{}, segments []pathSegment, depth int, value interface{}, remove bool) (interface{}, error) {
+	segment := segments[depth]
+	last := depth == len(segments)-1
+
+	if !segment.isIndex {
+		if container == nil {
+			if remove {
+				return nil, nil
+			}
+			container = map[string]interface{}{}
+		}
+		object, ok := container.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s is not an object.", pathString(segments, depth))
+		}
+
+		if last {
+			if remove {
+				delete(object, segment.key)
+			} else {
+				object[segment.key] = value
+			}
+			return object, nil
+		}
+
+		child, err := setSegments(object[segment.key], segments, depth+1, value, remove)
+		if err != nil {
+			return nil, err
+		}
+		if child != nil {
+			object[segment.key] = child
+		}
+		return object, nil
+	}
+
+	if container == nil {
+		if remove {
+			return nil, nil
+		}
+		container = []interface{}{}
+	}
+	array, ok := container.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not an array.", pathString(segments, depth))
+	}
+
+	if segment.index > len(array) || (segment.index == len(array) && remove) {
+		if remove {
+			return array, nil
+		}
+		return nil, fmt.Errorf("%s is out of range of %d elements.", pathString(segments, depth+1), len(array))
+	}
+
+	if last {
+		switch {
+		case remove:
+			array = append(array[:segment.index], array[segment.index+1:]...)
+		case segment.index == len(array):
+			array = append(array, value)
+		default:
+			array[segment.index] = value
+		}
+		return array, nil
+	}
+
+	var element interface{}
+	if segment.index < len(array) {
+		element = array[segment.index]
+	}
+	child, err := setSegments(element, segments, depth+1, value, remove)
+	if err != nil {
+		return nil, err
+	}
+	if segment.index == len(array) {
+		array = append(array, child)
+	} else if child != nil {
+		array[segment.index] = child
+	}
+	return array, nil
+}
+
+// SetPath sets value at the path in the record. Missing objects and arrays
+// on the path are created, and an element can be appended to an array by
+// setting the index next to the last element. Only the top-level key is
+// saved, so the record must have the current value of the top-level key
+// for a nested value to be set.
+func (r *Record) SetPath(path string, value interface{}) error {
+	return r.modifyPath(path, value, false)
+}
+
+// UnsetPath removes the value at the path in the record. A top-level key
+// is set to null, which removes the key when the record is saved, while a
+// nested value is removed from its object or array.
+func (r *Record) UnsetPath(path string) error {
+	return r.modifyPath(path, nil, true)
+}
+
+func (r *Record) modifyPath(path string, value interface{}, remove bool) error {
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if err := checkKey(segments[0].key); err != nil {
+		return err
+	}
+
+	if len(segments) == 1 {
+		r.Set(segments[0].key, value)
+		return nil
+	}
+
+	key := segments[0].key
+	child, err := setSegments(r.Data[key], segments, 1, value, remove)
+	if err != nil {
+		return err
+	}
+	if child != nil {
+		r.Set(key, child)
+	}
+	return nil
+}
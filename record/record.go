@@ -41,20 +41,64 @@ func (r *Record) Get(key string) (value interface{}, err error) {
 	return
 }
 
+// checkKey checks if the key can be set by the user
+func checkKey(key string) error {
+	if strings.HasPrefix(key, "_") {
+		return fmt.Errorf("Cannot set data with reserved key: %s", key)
+	}
+	return nil
+}
+
 // Assign is a convenient method for setting value to a key using
-// an expression syntax.
+// an expression syntax. The value of key=value is a string, which is empty
+// if the value is empty. The value of key:=value is parsed as JSON. The
+// key can be a path to a nested value, see SetPath.
 func (r *Record) Assign(expr string) error {
+	key, value, typed, err := ParseAssignment(expr)
+	if err != nil {
+		return err
+	}
+
+	if !typed {
+		return r.SetPath(key, value)
+	}
+
+	var typedValue interface{}
+	err = json.Unmarshal([]byte(value), &typedValue)
+	if err != nil {
+		return fmt.Errorf("Value of %s is not valid JSON: %s", key, err)
+	}
+	return r.SetPath(key, typedValue)
+}
+
+// ParseAssignment splits the assignment expression into the key and the
+// value. typed is true if the value is a JSON literal, i.e. the expression
+// is in the form of key:=value.
+func ParseAssignment(expr string) (key, value string, typed bool, err error) {
 	pair := strings.SplitN(expr, "=", 2)
-	if len(pair) < 2 || pair[0] == "" || pair[1] == "" {
-		return fmt.Errorf("Record assign '%s' not in correct format. Expected: key=value", expr)
+	key = pair[0]
+	if strings.HasSuffix(key, ":") {
+		key = strings.TrimSuffix(key, ":")
+		typed = true
+	}
+
+	if len(pair) < 2 || key == "" || (typed && pair[1] == "") {
+		err = fmt.Errorf("Record assign '%s' not in correct format. Expected: key=value or key:=json", expr)
+		return
 	}
+	value = pair[1]
+	return
+}
 
-	if strings.HasPrefix(pair[0], "_") {
-		return fmt.Errorf("Cannot set data with reserved key: %s", pair[0])
+// Unset sets the value of a key to null, which removes the key from the
+// record on the server when the record is saved. The key can be a path to
+// a nested value, see UnsetPath.
+func (r *Record) Unset(key string) error {
+	if key == "" {
+		return fmt.Errorf("Key cannot be empty.")
 	}
 
-	r.Set(pair[0], pair[1])
-	return nil
+	return r.UnsetPath(key)
 }
 
 // CheckRecordID checks if specified Record ID conforms to required format